@@ -0,0 +1,108 @@
+package boltstorage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nickalie/bots"
+	bolt "go.etcd.io/bbolt"
+)
+
+var stateBucket = []byte("state")
+
+type Storage struct {
+	db *bolt.DB
+}
+
+func New(path string) (*Storage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Storage{db: db}, nil
+}
+
+func (s *Storage) Read(ctx context.Context, key string) (*bots.StoreItem, error) {
+	var item *bots.StoreItem
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		item, err = get(tx, key)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if item == nil {
+		return nil, bots.ErrNotFound
+	}
+
+	return item, nil
+}
+
+func (s *Storage) Write(ctx context.Context, key string, item *bots.StoreItem) (string, error) {
+	etag := bots.NewETag()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		current, err := get(tx, key)
+
+		if err != nil {
+			return err
+		}
+
+		if item.ETag != bots.AnyETag && ((current != nil && current.ETag != item.ETag) || (current == nil && item.ETag != "")) {
+			return bots.ErrETagConflict
+		}
+
+		value, err := json.Marshal(&bots.StoreItem{Data: item.Data, ETag: etag})
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(stateBucket).Put([]byte(key), value)
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return etag, nil
+}
+
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(stateBucket).Delete([]byte(key))
+	})
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func get(tx *bolt.Tx, key string) (*bots.StoreItem, error) {
+	value := tx.Bucket(stateBucket).Get([]byte(key))
+
+	if value == nil {
+		return nil, nil
+	}
+
+	item := &bots.StoreItem{}
+	err := json.Unmarshal(value, item)
+	return item, err
+}
@@ -0,0 +1,116 @@
+package bottest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nickalie/bots"
+)
+
+func AssertText(t testing.TB, activity *bots.Activity, want string) {
+	t.Helper()
+
+	if activity == nil {
+		t.Fatalf("expected activity with text %q, got nil", want)
+	}
+
+	if activity.Text != want {
+		t.Errorf("expected text %q, got %q", want, activity.Text)
+	}
+}
+
+func AssertTextContains(t testing.TB, activity *bots.Activity, want string) {
+	t.Helper()
+
+	if activity == nil {
+		t.Fatalf("expected activity containing %q, got nil", want)
+	}
+
+	if !strings.Contains(activity.Text, want) {
+		t.Errorf("expected text containing %q, got %q", want, activity.Text)
+	}
+}
+
+func AssertAttachments(t testing.TB, activity *bots.Activity, contentTypes ...string) {
+	t.Helper()
+
+	if activity == nil {
+		t.Fatalf("expected activity with attachments %v, got nil", contentTypes)
+	}
+
+	var got []string
+
+	for _, a := range activity.Attachments {
+		got = append(got, a.ContentType)
+	}
+
+	if !equalStrings(got, contentTypes) {
+		t.Errorf("expected attachments %v, got %v", contentTypes, got)
+	}
+}
+
+func AssertHeroCardButtons(t testing.TB, activity *bots.Activity, titles ...string) {
+	t.Helper()
+
+	if activity == nil {
+		t.Fatalf("expected activity with hero card buttons %v, got nil", titles)
+	}
+
+	for _, a := range activity.Attachments {
+		card, ok := a.Content.(*bots.HeroCard)
+
+		if !ok || a.ContentType != bots.TypeHeroCard {
+			continue
+		}
+
+		if got := actionTitles(card.Buttons); !equalStrings(got, titles) {
+			t.Errorf("expected hero card buttons %v, got %v", titles, got)
+		}
+
+		return
+	}
+
+	t.Errorf("expected hero card with buttons %v, got none", titles)
+}
+
+func AssertSuggestedActions(t testing.TB, activity *bots.Activity, titles ...string) {
+	t.Helper()
+
+	if activity == nil {
+		t.Fatalf("expected activity with suggested actions %v, got nil", titles)
+	}
+
+	var got []string
+
+	if activity.SuggestedActions != nil {
+		got = actionTitles(activity.SuggestedActions.Actions)
+	}
+
+	if !equalStrings(got, titles) {
+		t.Errorf("expected suggested actions %v, got %v", titles, got)
+	}
+}
+
+func actionTitles(actions []*bots.CardAction) []string {
+	var result []string
+
+	for _, action := range actions {
+		result = append(result, action.Title)
+	}
+
+	return result
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
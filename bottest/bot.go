@@ -0,0 +1,290 @@
+package bottest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nickalie/bots"
+)
+
+const (
+	CallSend   = "send"
+	CallUpdate = "update"
+	CallDelete = "delete"
+
+	DefaultChannel = "test"
+	DefaultTimeout = 5 * time.Second
+)
+
+type Call struct {
+	Method   string
+	Activity *bots.Activity
+}
+
+type Bot struct {
+	Channel    string
+	Timeout    time.Duration
+	Files      map[string][]byte
+	SendFunc   func(ctx context.Context, activity *bots.Activity) (*bots.Identification, error)
+	UpdateFunc func(ctx context.Context, activity *bots.Activity) (*bots.Identification, error)
+	DeleteFunc func(ctx context.Context, activity *bots.Activity) error
+	updates    chan *bots.Activity
+	outgoing   chan *Call
+	done       chan struct{}
+	inFlight   sync.WaitGroup
+	mu         sync.Mutex
+	calls      []*Call
+	closed     bool
+	lastId     int64
+}
+
+func NewBot() *Bot {
+	return &Bot{
+		Channel:  DefaultChannel,
+		Timeout:  DefaultTimeout,
+		Files:    make(map[string][]byte),
+		updates:  make(chan *bots.Activity),
+		outgoing: make(chan *Call, 1000),
+		done:     make(chan struct{}),
+	}
+}
+
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *Bot) NewActivity(activityType bots.ActivityType, text string) *bots.Activity {
+	user := &bots.ChannelAccount{Identification: bots.Identification{Id: "user"}, Name: "user"}
+	bot := &bots.ChannelAccount{Identification: bots.Identification{Id: "bot"}, Name: "bot"}
+	activity := &bots.Activity{}
+	activity.Id = b.nextId()
+	activity.Type = activityType
+	activity.Text = text
+	activity.ChannelId = b.Channel
+	activity.From = user
+	activity.Recipient = bot
+	activity.Conversation = &bots.ConversationAccount{ChannelAccount: bots.ChannelAccount{
+		Identification: bots.Identification{Id: "conversation"},
+	}}
+	return activity
+}
+
+func (b *Bot) Inject(activity *bots.Activity) error {
+	if activity.ChannelId == "" {
+		activity.ChannelId = b.Channel
+	}
+
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return bots.ErrBotClosed
+	}
+
+	b.inFlight.Add(1)
+	b.mu.Unlock()
+	defer b.inFlight.Done()
+
+	select {
+	case b.updates <- activity:
+		return nil
+	case <-b.done:
+		return bots.ErrBotClosed
+	case <-time.After(b.Timeout):
+		return errors.New("bottest: activity was not consumed within " + b.Timeout.String())
+	}
+}
+
+func (b *Bot) Say(text string) (*bots.Activity, error) {
+	activity := b.NewActivity(bots.TypeMessage, text)
+	return activity, b.Inject(activity)
+}
+
+func (b *Bot) Next() (*Call, error) {
+	select {
+	case call := <-b.outgoing:
+		return call, nil
+	case <-time.After(b.Timeout):
+		return nil, errors.New("bottest: no outgoing activity within " + b.Timeout.String())
+	}
+}
+
+func (b *Bot) Calls() []*Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Call(nil), b.calls...)
+}
+
+func (b *Bot) Sent() []*bots.Activity {
+	return b.activities(CallSend)
+}
+
+func (b *Bot) Updated() []*bots.Activity {
+	return b.activities(CallUpdate)
+}
+
+func (b *Bot) Deleted() []*bots.Activity {
+	return b.activities(CallDelete)
+}
+
+func (b *Bot) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = nil
+
+	for {
+		select {
+		case <-b.outgoing:
+		default:
+			return
+		}
+	}
+}
+
+func (b *Bot) activities(method string) []*bots.Activity {
+	var result []*bots.Activity
+
+	for _, call := range b.Calls() {
+		if call.Method == method {
+			result = append(result, call.Activity)
+		}
+	}
+
+	return result
+}
+
+func (b *Bot) record(method string, activity *bots.Activity) {
+	call := &Call{Method: method, Activity: activity}
+	b.mu.Lock()
+	b.calls = append(b.calls, call)
+	b.mu.Unlock()
+
+	select {
+	case b.outgoing <- call:
+	default:
+	}
+}
+
+func (b *Bot) nextId() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastId++
+	return strconv.FormatInt(b.lastId, 10)
+}
+
+func (b *Bot) Send(activity *bots.Activity) (*bots.Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *Bot) SendContext(ctx context.Context, activity *bots.Activity) (*bots.Identification, error) {
+	b.record(CallSend, activity)
+
+	if b.SendFunc != nil {
+		return b.SendFunc(ctx, activity)
+	}
+
+	return &bots.Identification{Id: b.nextId()}, nil
+}
+
+func (b *Bot) Update(activity *bots.Activity) (*bots.Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *Bot) UpdateContext(ctx context.Context, activity *bots.Activity) (*bots.Identification, error) {
+	b.record(CallUpdate, activity)
+
+	if b.UpdateFunc != nil {
+		return b.UpdateFunc(ctx, activity)
+	}
+
+	return &bots.Identification{Id: activity.Id}, nil
+}
+
+func (b *Bot) Delete(activity *bots.Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *Bot) DeleteContext(ctx context.Context, activity *bots.Activity) error {
+	b.record(CallDelete, activity)
+
+	if b.DeleteFunc != nil {
+		return b.DeleteFunc(ctx, activity)
+	}
+
+	return nil
+}
+
+func (b *Bot) GetUpdatesChannel() (<-chan *bots.Activity, error) {
+	return b.updates, nil
+}
+
+func (b *Bot) GetUpdatesChannelContext(ctx context.Context) (<-chan *bots.Activity, error) {
+	result := make(chan *bots.Activity)
+
+	go func() {
+		defer close(result)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-b.updates:
+				if !ok {
+					return
+				}
+
+				select {
+				case result <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return result, nil
+}
+
+func (b *Bot) GetFile(attachment *bots.Attachment, activity *bots.Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *Bot) GetFileContext(ctx context.Context, attachment *bots.Attachment, activity *bots.Activity) (*http.Response, error) {
+	data, ok := b.Files[attachment.ContentUrl]
+
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (b *Bot) GetChannels() []string {
+	return []string{b.Channel}
+}
+
+func (b *Bot) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return bots.ErrBotClosed
+	}
+
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+	b.inFlight.Wait()
+	close(b.updates)
+	return nil
+}
+
+func (b *Bot) Close() error {
+	return b.Shutdown(context.Background())
+}
@@ -0,0 +1,179 @@
+package bottest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+)
+
+func TestBotInject(t *testing.T) {
+	bot := NewBot()
+	updates, _ := bot.GetUpdatesChannel()
+	received := make(chan *bots.Activity, 1)
+
+	go func() {
+		received <- <-updates
+	}()
+
+	activity, err := bot.Say("hi")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-received; got != activity || got.Text != "hi" || got.ChannelId != DefaultChannel || got.Type != bots.TypeMessage {
+		t.Fatalf("unexpected activity %+v", got)
+	}
+
+	bot.Timeout = 20 * time.Millisecond
+
+	if _, err := bot.Say("unread"); err == nil {
+		t.Fatal("expected an error for an activity nobody consumed")
+	}
+}
+
+func TestBotRecordsCalls(t *testing.T) {
+	bot := NewBot()
+	activity := bot.NewActivity(bots.TypeMessage, "hi")
+	id, err := bot.Send(activity.Response("hello"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated := activity.Response("edited")
+	updated.Id = id.Id
+
+	if got, err := bot.Update(updated); err != nil || got.Id != id.Id {
+		t.Fatalf("Update = %+v, %v", got, err)
+	}
+
+	if err := bot.Delete(updated); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{CallSend, CallUpdate, CallDelete} {
+		call, err := bot.Next()
+
+		if err != nil || call.Method != want {
+			t.Fatalf("Next = %+v, %v, want %s", call, err, want)
+		}
+	}
+
+	if len(bot.Calls()) != 3 || len(bot.Sent()) != 1 || len(bot.Updated()) != 1 || len(bot.Deleted()) != 1 {
+		t.Fatalf("unexpected calls %+v", bot.Calls())
+	}
+
+	AssertText(t, bot.Sent()[0], "hello")
+	bot.Reset()
+	bot.Timeout = 20 * time.Millisecond
+
+	if calls := bot.Calls(); len(calls) != 0 {
+		t.Fatalf("calls after Reset = %+v", calls)
+	}
+
+	if _, err := bot.Next(); err == nil {
+		t.Fatal("Next returned a call after Reset")
+	}
+}
+
+func TestBotFuncs(t *testing.T) {
+	errSend := errors.New("send failed")
+	bot := NewBot()
+	bot.SendFunc = func(ctx context.Context, activity *bots.Activity) (*bots.Identification, error) {
+		return nil, errSend
+	}
+
+	if _, err := bot.Send(bot.NewActivity(bots.TypeMessage, "hi")); err != errSend {
+		t.Fatalf("Send = %v, want %v", err, errSend)
+	}
+
+	if sent := bot.Sent(); len(sent) != 1 {
+		t.Fatalf("failed send was not recorded: %+v", sent)
+	}
+}
+
+func TestBotGetFile(t *testing.T) {
+	bot := NewBot()
+	bot.Files["https://example.com/a.txt"] = []byte("content")
+	activity := bot.NewActivity(bots.TypeMessage, "")
+
+	resp, err := bot.GetFile(&bots.Attachment{ContentUrl: "https://example.com/a.txt"}, activity)
+
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("GetFile = %+v, %v", resp, err)
+	}
+
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "content" {
+		t.Fatalf("body = %q", body)
+	}
+
+	if resp, err = bot.GetFile(&bots.Attachment{ContentUrl: "https://example.com/b.txt"}, activity); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GetFile of a missing file = %+v, %v", resp, err)
+	}
+}
+
+func TestBotShutdown(t *testing.T) {
+	bot := NewBot()
+	updates, _ := bot.GetUpdatesChannel()
+	injected := make(chan error, 1)
+
+	go func() {
+		_, err := bot.Say("in flight")
+		injected <- err
+	}()
+
+	// Let the Say block on the unread updates channel before shutting down.
+	time.Sleep(20 * time.Millisecond)
+
+	if err := bot.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-injected; err != bots.ErrBotClosed {
+		t.Fatalf("in-flight Say = %v, want %v", err, bots.ErrBotClosed)
+	}
+
+	if _, ok := <-updates; ok {
+		t.Fatal("updates channel is open after Shutdown")
+	}
+
+	if err := bot.Inject(bot.NewActivity(bots.TypeMessage, "late")); err != bots.ErrBotClosed {
+		t.Fatalf("Inject after Shutdown = %v, want %v", err, bots.ErrBotClosed)
+	}
+
+	if err := bot.Close(); err != bots.ErrBotClosed {
+		t.Fatalf("second Close = %v, want %v", err, bots.ErrBotClosed)
+	}
+}
+
+func TestBotContextUpdates(t *testing.T) {
+	bot := NewBot()
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, _ := bot.GetUpdatesChannelContext(ctx)
+
+	go bot.Say("hi")
+
+	select {
+	case activity := <-updates:
+		AssertText(t, activity, "hi")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no activity delivered")
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("unexpected activity after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("updates channel was not closed")
+	}
+}
@@ -0,0 +1,72 @@
+package bottest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+)
+
+type StepKind int
+
+const (
+	StepBot StepKind = iota
+	StepUser
+)
+
+type Step struct {
+	Kind  StepKind
+	User  string
+	Bot   string
+	Check func(t testing.TB, activity *bots.Activity)
+}
+
+type Transcript []Step
+
+func UserSays(text string) Step {
+	return Step{Kind: StepUser, User: text}
+}
+
+func BotReplies(text string) Step {
+	return Step{Kind: StepBot, Bot: text}
+}
+
+func BotRepliesWith(check func(t testing.TB, activity *bots.Activity)) Step {
+	return Step{Kind: StepBot, Check: check}
+}
+
+func RunTranscript(t testing.TB, bot *Bot, transcript Transcript) {
+	t.Helper()
+
+	for i, step := range transcript {
+		if step.Kind == StepUser {
+			if _, err := bot.Say(step.User); err != nil {
+				t.Fatalf("step %d: %v", i, err)
+			}
+
+			continue
+		}
+
+		call, err := bot.Next()
+
+		if err != nil {
+			t.Fatalf("step %d: expected bot reply: %v", i, err)
+		}
+
+		if call.Method != CallSend {
+			t.Fatalf("step %d: expected bot to send, got %s", i, call.Method)
+		}
+
+		if step.Check != nil {
+			step.Check(t, call.Activity)
+		} else {
+			AssertText(t, call.Activity, step.Bot)
+		}
+	}
+
+	select {
+	case call := <-bot.outgoing:
+		t.Errorf("unexpected %s after transcript: %q", call.Method, call.Activity.Text)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
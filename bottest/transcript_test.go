@@ -0,0 +1,137 @@
+package bottest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+)
+
+// recordingT collects failures instead of failing the test that runs it.
+type recordingT struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+	fatal  bool
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.mu.Lock()
+	t.fatal = true
+	t.mu.Unlock()
+	panic(t)
+}
+
+// run runs f the way the testing package runs a test, stopping at Fatalf.
+func (t *recordingT) run(f func(t testing.TB)) {
+	defer func() {
+		if r := recover(); r != nil && r != t {
+			panic(r)
+		}
+	}()
+
+	f(t)
+}
+
+// echo replies to every message with its upper case text, twice for "twice"
+// and not at all for "quiet".
+func echo(bot *Bot) {
+	updates, _ := bot.GetUpdatesChannel()
+
+	go func() {
+		for activity := range updates {
+			switch activity.Text {
+			case "quiet":
+			case "twice":
+				bot.Send(activity.Response("ONE"))
+				bot.Send(activity.Response("TWO"))
+			default:
+				bot.Send(activity.Response(strings.ToUpper(activity.Text)))
+			}
+		}
+	}()
+}
+
+func TestRunTranscript(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcript Transcript
+		errors     int
+		fatal      bool
+	}{
+		{"passes", Transcript{
+			UserSays("hi"),
+			BotReplies("HI"),
+			UserSays("twice"),
+			BotReplies("ONE"),
+			BotRepliesWith(func(t testing.TB, activity *bots.Activity) {
+				AssertTextContains(t, activity, "WO")
+			}),
+		}, 0, false},
+		{"wrong text", Transcript{UserSays("hi"), BotReplies("hello")}, 1, false},
+		{"missing reply", Transcript{UserSays("quiet"), BotReplies("anything")}, 1, true},
+		{"unexpected reply", Transcript{UserSays("twice"), BotReplies("ONE")}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewBot()
+			bot.Timeout = 100 * time.Millisecond
+			defer bot.Close()
+			echo(bot)
+			recorder := &recordingT{TB: t}
+			recorder.run(func(t testing.TB) { RunTranscript(t, bot, tt.transcript) })
+
+			if len(recorder.errors) != tt.errors || recorder.fatal != tt.fatal {
+				t.Fatalf("errors = %q, fatal = %v, want %d errors, fatal = %v", recorder.errors, recorder.fatal, tt.errors, tt.fatal)
+			}
+		})
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	card := &bots.HeroCard{Buttons: []*bots.CardAction{{Title: "Yes"}, {Title: "No"}}}
+	activity := &bots.Activity{
+		Text:             "pick one",
+		Attachments:      []*bots.Attachment{{ContentType: bots.TypeHeroCard, Content: card}},
+		SuggestedActions: &bots.SuggestedActions{Actions: []*bots.CardAction{{Title: "A"}, {Title: "B"}}},
+	}
+
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+		ok     bool
+	}{
+		{"text", func(t testing.TB) { AssertText(t, activity, "pick one") }, true},
+		{"wrong text", func(t testing.TB) { AssertText(t, activity, "pick") }, false},
+		{"contains", func(t testing.TB) { AssertTextContains(t, activity, "pick") }, true},
+		{"attachments", func(t testing.TB) { AssertAttachments(t, activity, bots.TypeHeroCard) }, true},
+		{"wrong attachments", func(t testing.TB) { AssertAttachments(t, activity, "image/png") }, false},
+		{"buttons", func(t testing.TB) { AssertHeroCardButtons(t, activity, "Yes", "No") }, true},
+		{"wrong buttons", func(t testing.TB) { AssertHeroCardButtons(t, activity, "No", "Yes") }, false},
+		{"suggested actions", func(t testing.TB) { AssertSuggestedActions(t, activity, "A", "B") }, true},
+		{"missing suggested actions", func(t testing.TB) { AssertSuggestedActions(t, &bots.Activity{}, "A") }, false},
+		{"nil activity", func(t testing.TB) { AssertText(t, nil, "") }, false},
+	}
+
+	for _, tt := range tests {
+		recorder := &recordingT{TB: t}
+		recorder.run(tt.assert)
+
+		if (len(recorder.errors) == 0) != tt.ok {
+			t.Errorf("%s: errors = %q, want ok = %v", tt.name, recorder.errors, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const DefaultBroadcastParallelism = 8
+
+type BroadcastOptions struct {
+	Parallelism int
+}
+
+type BroadcastResult struct {
+	Reference *ConversationReference
+	Id        *Identification
+	Err       error
+}
+
+type BroadcastReport struct {
+	Results []*BroadcastResult
+}
+
+func (r *BroadcastReport) Succeeded() (result []*BroadcastResult) {
+	for _, v := range r.Results {
+		if v.Err == nil {
+			result = append(result, v)
+		}
+	}
+
+	return
+}
+
+func (r *BroadcastReport) Failed() (result []*BroadcastResult) {
+	for _, v := range r.Results {
+		if v.Err != nil {
+			result = append(result, v)
+		}
+	}
+
+	return
+}
+
+type Broadcaster interface {
+	BroadcastContext(ctx context.Context, references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error)
+}
+
+func UserReferences(channelId string, ids ...string) []*ConversationReference {
+	result := make([]*ConversationReference, 0, len(ids))
+
+	for _, id := range ids {
+		user := &ChannelAccount{Identification: Identification{Id: id}}
+		result = append(result, &ConversationReference{
+			ChannelId:    channelId,
+			User:         user,
+			Conversation: &ConversationAccount{ChannelAccount: *user},
+		})
+	}
+
+	return result
+}
+
+func Broadcast(ctx context.Context, bot Bot, references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error) {
+	if b, ok := bot.(Broadcaster); ok {
+		return b.BroadcastContext(ctx, references, activity, options)
+	}
+
+	return sendEach(ctx, bot, references, activity, options)
+}
+
+func (b *MultiBot) Broadcast(references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error) {
+	return b.BroadcastContext(context.Background(), references, activity, options)
+}
+
+func (b *MultiBot) BroadcastContext(ctx context.Context, references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error) {
+	report := &BroadcastReport{Results: make([]*BroadcastResult, len(references))}
+	groups := make(map[Bot][]int)
+	var order []Bot
+
+	for i, reference := range references {
+		var bot Bot
+
+		if reference != nil {
+			bot = b.findBotByChannel(reference.ChannelId)
+		}
+
+		if bot == nil {
+			report.Results[i] = &BroadcastResult{Reference: reference, Err: errors.New("MultiBot.Broadcast: Unknown platform")}
+			continue
+		}
+
+		if _, ok := groups[bot]; !ok {
+			order = append(order, bot)
+		}
+
+		groups[bot] = append(groups[bot], i)
+	}
+
+	for _, bot := range order {
+		indexes := groups[bot]
+		group := make([]*ConversationReference, len(indexes))
+
+		for i, index := range indexes {
+			group[i] = references[index]
+		}
+
+		result, err := Broadcast(ctx, bot, group, activity, options)
+
+		for i, index := range indexes {
+			if err != nil {
+				report.Results[index] = &BroadcastResult{Reference: references[index], Err: err}
+			} else {
+				report.Results[index] = result.Results[i]
+			}
+		}
+	}
+
+	return report, nil
+}
+
+func sendEach(ctx context.Context, bot Bot, references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error) {
+	report := &BroadcastReport{Results: make([]*BroadcastResult, len(references))}
+
+	fanOut(len(references), options, func(i int) {
+		result := &BroadcastResult{Reference: references[i]}
+
+		if err := ctx.Err(); err != nil {
+			result.Err = err
+		} else {
+			a := *activity
+			result.Id, result.Err = SendProactive(ctx, bot, references[i], &a)
+		}
+
+		report.Results[i] = result
+	})
+
+	return report, nil
+}
+
+func fanOut(n int, options *BroadcastOptions, f func(i int)) {
+	parallelism := DefaultBroadcastParallelism
+
+	if options != nil && options.Parallelism > 0 {
+		parallelism = options.Parallelism
+	}
+
+	tokens := make(chan struct{}, parallelism)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < n; i++ {
+		tokens <- struct{}{}
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			f(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
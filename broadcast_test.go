@@ -0,0 +1,214 @@
+package bots_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/vibertest"
+)
+
+func userIds(prefix string, n int) []string {
+	ids := make([]string, n)
+
+	for i := range ids {
+		ids[i] = prefix + strconv.Itoa(i)
+	}
+
+	return ids
+}
+
+func TestBroadcastSendEach(t *testing.T) {
+	errBlocked := errors.New("blocked")
+	fake := fakeBot("test")
+	var running, peak int32
+
+	fake.SendFunc = func(ctx context.Context, activity *bots.Activity) (*bots.Identification, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			p := atomic.LoadInt32(&peak)
+
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+
+		time.Sleep(5 * time.Millisecond)
+
+		if activity.Recipient.Id == "u3" {
+			return nil, errBlocked
+		}
+
+		return &bots.Identification{Id: "sent-" + activity.Recipient.Id}, nil
+	}
+
+	references := bots.UserReferences("test", userIds("u", 10)...)
+	activity := &bots.Activity{Type: bots.TypeMessage, Text: "news"}
+	report, err := bots.Broadcast(context.Background(), fake, references, activity, &bots.BroadcastOptions{Parallelism: 3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Results) != 10 || len(report.Succeeded()) != 9 || len(report.Failed()) != 1 {
+		t.Fatalf("got %d results, %d succeeded, %d failed", len(report.Results), len(report.Succeeded()), len(report.Failed()))
+	}
+
+	for i, result := range report.Results {
+		id := references[i].User.Id
+
+		if result.Reference != references[i] {
+			t.Fatalf("result %d is for %+v", i, result.Reference)
+		}
+
+		if id == "u3" {
+			if result.Err != errBlocked || result.Id != nil {
+				t.Fatalf("result for u3 = %+v", result)
+			}
+		} else if result.Err != nil || result.Id.Id != "sent-"+id {
+			t.Fatalf("result for %s = %+v", id, result)
+		}
+	}
+
+	if p := atomic.LoadInt32(&peak); p > 3 {
+		t.Fatalf("%d sends ran at once, want at most 3", p)
+	}
+
+	for _, sent := range fake.Sent() {
+		if sent.Text != "news" || sent.Conversation.Id != sent.Recipient.Id {
+			t.Fatalf("unexpected sent activity %+v", sent)
+		}
+	}
+
+	if activity.Recipient != nil || activity.Conversation != nil {
+		t.Fatalf("broadcast changed the activity: %+v", activity)
+	}
+}
+
+func TestBroadcastCancelled(t *testing.T) {
+	fake := fakeBot("test")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := bots.Broadcast(ctx, fake, bots.UserReferences("test", "u1", "u2"), &bots.Activity{Text: "news"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, result := range report.Results {
+		if result.Err != context.Canceled {
+			t.Fatalf("result = %+v, want %v", result, context.Canceled)
+		}
+	}
+
+	if sent := fake.Sent(); len(sent) != 0 {
+		t.Fatalf("cancelled broadcast sent %d activities", len(sent))
+	}
+}
+
+func TestViberBroadcastChunks(t *testing.T) {
+	server := vibertest.NewServer("token")
+	defer server.Close()
+	server.Unsubscribe("v301")
+	bot, err := bots.NewViberBot(server.Config(""))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	references := append(bots.UserReferences(bots.ChannelViber, userIds("v", 650)...), nil)
+	report, err := bot.Broadcast(references, &bots.Activity{Type: bots.TypeMessage, Text: "news"}, &bots.BroadcastOptions{Parallelism: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := make(map[uint64]int)
+
+	for _, message := range server.Messages() {
+		if message.Text != "news" {
+			t.Fatalf("unexpected message %+v", message)
+		}
+
+		chunks[message.Token] = len(message.BroadcastList)
+	}
+
+	sizes := make(map[int]int)
+
+	for _, size := range chunks {
+		sizes[size]++
+	}
+
+	if len(chunks) != 3 || sizes[300] != 2 || sizes[50] != 1 {
+		t.Fatalf("broadcast_message chunk sizes = %v, want 300, 300 and 50", sizes)
+	}
+
+	if len(report.Results) != 651 || len(report.Failed()) != 2 {
+		t.Fatalf("got %d results, %d failed", len(report.Results), len(report.Failed()))
+	}
+
+	for i, result := range report.Results {
+		switch {
+		case i == 650:
+			if result.Err == nil {
+				t.Fatal("nil reference did not fail")
+			}
+		case i == 301:
+			if result.Err == nil || result.Id != nil {
+				t.Fatalf("unsubscribed user result = %+v", result)
+			}
+		case result.Err != nil || result.Id == nil:
+			t.Fatalf("result %d = %+v", i, result)
+		}
+	}
+
+	if report.Results[0].Id.Id != report.Results[299].Id.Id || report.Results[0].Id.Id == report.Results[300].Id.Id {
+		t.Fatal("message tokens do not follow the 300 recipient chunks")
+	}
+}
+
+func TestMultiBotBroadcastPartialFailure(t *testing.T) {
+	down := vibertest.NewServer("token")
+	down.Close()
+	viberBot, err := bots.NewViberBot(&bots.ViberBotConfig{Token: "token", APIEndpoint: down.URL, Retry: &bots.RetryPolicy{}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := fakeBot("test")
+	bot := bots.NewMultiBot(viberBot, fake)
+	references := []*bots.ConversationReference{
+		bots.UserReferences(bots.ChannelViber, "v1")[0],
+		bots.UserReferences("test", "t1")[0],
+		bots.UserReferences("unknown", "x1")[0],
+		bots.UserReferences(bots.ChannelViber, "v2")[0],
+		bots.UserReferences("test", "t2")[0],
+	}
+
+	report, err := bot.Broadcast(references, &bots.Activity{Type: bots.TypeMessage, Text: "news"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, result := range report.Results {
+		if result.Reference != references[i] {
+			t.Fatalf("result %d is for %+v", i, result.Reference)
+		}
+
+		if ok := references[i].ChannelId == "test"; ok != (result.Err == nil) {
+			t.Fatalf("result %d for %s = %+v", i, references[i].ChannelId, result)
+		}
+	}
+
+	if sent := fake.Sent(); len(sent) != 2 {
+		t.Fatalf("test platform got %d sends, want 2", len(sent))
+	}
+}
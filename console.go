@@ -0,0 +1,240 @@
+package bots
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var consoleChannels = []string{ChannelConsole}
+
+type ConsoleBotConfig struct {
+	In       io.Reader
+	Out      io.Writer
+	UserName string
+	BotName  string
+}
+
+type ConsoleBot struct {
+	config    *ConsoleBotConfig
+	updates   chan *Activity
+	lifecycle *lifecycle
+	start     sync.Once
+	mu        sync.Mutex
+	lastId    int64
+}
+
+func NewConsoleBot(config *ConsoleBotConfig) *ConsoleBot {
+	if config == nil {
+		config = &ConsoleBotConfig{}
+	}
+
+	if config.In == nil {
+		config.In = os.Stdin
+	}
+
+	if config.Out == nil {
+		config.Out = os.Stdout
+	}
+
+	if config.UserName == "" {
+		config.UserName = "user"
+	}
+
+	if config.BotName == "" {
+		config.BotName = "bot"
+	}
+
+	return &ConsoleBot{
+		config:    config,
+		updates:   make(chan *Activity),
+		lifecycle: newLifecycle(),
+	}
+}
+
+func (b *ConsoleBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (b *ConsoleBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	b.start.Do(func() {
+		go b.read()
+	})
+
+	return b.updates, nil
+}
+
+func (b *ConsoleBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	updates, _ := b.GetUpdatesChannel()
+	return forwardUpdates(ctx, updates), nil
+}
+
+func (b *ConsoleBot) read() {
+	defer b.Close()
+
+	if !b.emit(TypeConversationUpdate, "") {
+		return
+	}
+
+	scanner := bufio.NewScanner(b.config.In)
+
+	for scanner.Scan() {
+		if !b.emit(TypeMessage, scanner.Text()) {
+			return
+		}
+	}
+}
+
+func (b *ConsoleBot) emit(activityType ActivityType, text string) bool {
+	if !b.lifecycle.enter() {
+		return false
+	}
+
+	defer b.lifecycle.leave()
+	user := &ChannelAccount{Identification: Identification{Id: b.config.UserName}, Name: b.config.UserName}
+	bot := &ChannelAccount{Identification: Identification{Id: b.config.BotName}, Name: b.config.BotName}
+
+	activity := &Activity{}
+	activity.Id = b.nextId()
+	activity.ChannelId = ChannelConsole
+	activity.Type = activityType
+	activity.Text = text
+	activity.From = user
+	activity.Recipient = bot
+	activity.Conversation = &ConversationAccount{ChannelAccount: *user}
+
+	if activityType == TypeConversationUpdate {
+		activity.MembersAdded = []*ChannelAccount{user, bot}
+	}
+
+	return b.lifecycle.deliver(b.updates, activity)
+}
+
+func (b *ConsoleBot) nextId() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastId++
+	return strconv.FormatInt(b.lastId, 10)
+}
+
+func (b *ConsoleBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *ConsoleBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if activity.Type == TypeTyping {
+		b.print(b.config.BotName + " is typing...\n")
+		return nil, nil
+	}
+
+	id := b.nextId()
+	b.print(formatConsoleActivity(b.config.BotName, activity))
+	return &Identification{Id: id}, nil
+}
+
+func (b *ConsoleBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *ConsoleBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	b.print(formatConsoleActivity(b.config.BotName+" (edited #"+activity.Id+")", activity))
+	return &Identification{Id: activity.Id}, nil
+}
+
+func (b *ConsoleBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *ConsoleBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	b.print(b.config.BotName + " deleted message #" + activity.Id + "\n")
+	return nil
+}
+
+func (b *ConsoleBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *ConsoleBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	if strings.HasPrefix(attachment.ContentUrl, "http://") || strings.HasPrefix(attachment.ContentUrl, "https://") {
+		req, err := http.NewRequest(http.MethodGet, attachment.ContentUrl, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return http.DefaultClient.Do(req.WithContext(ctx))
+	}
+
+	f, err := os.Open(strings.TrimPrefix(attachment.ContentUrl, "file://"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: f, Header: make(http.Header)}, nil
+}
+
+func (b *ConsoleBot) GetChannels() []string {
+	return consoleChannels
+}
+
+func (b *ConsoleBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *ConsoleBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *ConsoleBot) print(s string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	io.WriteString(b.config.Out, s)
+}
+
+func formatConsoleActivity(name string, activity *Activity) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s: %s\n", name, activity.Text)
+
+	for _, a := range activity.Attachments {
+		if card, ok := a.Content.(*HeroCard); ok && a.ContentType == TypeHeroCard {
+			if card.Title != "" {
+				fmt.Fprintf(sb, "  == %s ==\n", card.Title)
+			}
+
+			if card.Text != "" {
+				fmt.Fprintf(sb, "  %s\n", card.Text)
+			}
+
+			for _, image := range card.Images {
+				fmt.Fprintf(sb, "  image: %s\n", image.Url)
+			}
+
+			for i, button := range card.Buttons {
+				fmt.Fprintf(sb, "  [%d] %s -> %s\n", i+1, button.Title, button.Value)
+			}
+		} else {
+			fmt.Fprintf(sb, "  attachment: %s %s %s\n", a.ContentType, a.Name, a.ContentUrl)
+		}
+	}
+
+	if activity.SuggestedActions != nil && len(activity.SuggestedActions.Actions) > 0 {
+		sb.WriteString("  suggested:")
+
+		for _, action := range activity.SuggestedActions.Actions {
+			fmt.Fprintf(sb, " [%s]", action.Title)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
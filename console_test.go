@@ -0,0 +1,168 @@
+package bots_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+)
+
+func TestConsoleBotConversation(t *testing.T) {
+	out := &bytes.Buffer{}
+	bot := bots.NewConsoleBot(&bots.ConsoleBotConfig{
+		In:       strings.NewReader("hello\nsecond\n"),
+		Out:      out,
+		UserName: "ann",
+		BotName:  "helper",
+	})
+
+	updates, err := bot.GetUpdatesChannel()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var activities []*bots.Activity
+
+	for activity := range updates {
+		activities = append(activities, activity)
+	}
+
+	if len(activities) != 3 {
+		t.Fatalf("got %d activities, want a conversation update and two messages", len(activities))
+	}
+
+	update := activities[0]
+
+	if update.Type != bots.TypeConversationUpdate || update.Id != "1" || len(update.MembersAdded) != 2 ||
+		update.MembersAdded[0].Id != "ann" || update.MembersAdded[1].Id != "helper" {
+		t.Fatalf("unexpected conversation update %+v", update)
+	}
+
+	for i, text := range []string{"hello", "second"} {
+		activity := activities[i+1]
+
+		if activity.Type != bots.TypeMessage || activity.Text != text || activity.Id != []string{"2", "3"}[i] ||
+			activity.ChannelId != bots.ChannelConsole || activity.From.Id != "ann" || activity.Recipient.Id != "helper" ||
+			activity.Conversation.Id != "ann" {
+			t.Fatalf("unexpected message %+v", activity)
+		}
+	}
+
+	id, err := bot.Send(activities[2].Response("hi"))
+
+	if err != nil || id.Id != "4" {
+		t.Fatalf("Send = %+v, %v, want id 4", id, err)
+	}
+
+	if got := out.String(); got != "helper: hi\n" {
+		t.Fatalf("output = %q", got)
+	}
+
+	if err := bot.Close(); err != bots.ErrBotClosed {
+		t.Fatalf("Close after EOF = %v, want %v", err, bots.ErrBotClosed)
+	}
+}
+
+func TestConsoleBotRendering(t *testing.T) {
+	card := &bots.HeroCard{
+		Title:   "Pizza",
+		Text:    "Large, extra cheese",
+		Images:  []*bots.CardImage{{Url: "https://example.com/pizza.png"}},
+		Buttons: []*bots.CardAction{{Type: bots.TypeImBack, Title: "Order", Value: "order"}, {Type: bots.TypeImBack, Title: "Skip", Value: "skip"}},
+	}
+
+	message := func(text string) *bots.Activity {
+		return &bots.Activity{Type: bots.TypeMessage, Text: text}
+	}
+
+	tests := []struct {
+		name     string
+		activity *bots.Activity
+		call     func(bot *bots.ConsoleBot, activity *bots.Activity) error
+		want     string
+	}{
+		{"text", message("hello"), nil, "helper: hello\n"},
+		{"hero card", &bots.Activity{Type: bots.TypeMessage, Text: "menu", Attachments: []*bots.Attachment{
+			{ContentType: bots.TypeHeroCard, Content: card},
+		}}, nil, "helper: menu\n" +
+			"  == Pizza ==\n" +
+			"  Large, extra cheese\n" +
+			"  image: https://example.com/pizza.png\n" +
+			"  [1] Order -> order\n" +
+			"  [2] Skip -> skip\n"},
+		{"attachment", &bots.Activity{Type: bots.TypeMessage, Text: "file", Attachments: []*bots.Attachment{
+			{ContentType: "application/pdf", Name: "menu.pdf", ContentUrl: "https://example.com/menu.pdf"},
+		}}, nil, "helper: file\n  attachment: application/pdf menu.pdf https://example.com/menu.pdf\n"},
+		{"suggested actions", &bots.Activity{Type: bots.TypeMessage, Text: "size?", SuggestedActions: &bots.SuggestedActions{
+			Actions: []*bots.CardAction{{Title: "S"}, {Title: "L"}},
+		}}, nil, "helper: size?\n  suggested: [S] [L]\n"},
+		{"typing", &bots.Activity{Type: bots.TypeTyping}, nil, "helper is typing...\n"},
+		{"update", &bots.Activity{Type: bots.TypeMessage, Id: "7", Text: "fixed"}, func(bot *bots.ConsoleBot, activity *bots.Activity) error {
+			_, err := bot.Update(activity)
+			return err
+		}, "helper (edited #7): fixed\n"},
+		{"delete", &bots.Activity{Type: bots.TypeMessage, Id: "7"}, func(bot *bots.ConsoleBot, activity *bots.Activity) error {
+			return bot.Delete(activity)
+		}, "helper deleted message #7\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			bot := bots.NewConsoleBot(&bots.ConsoleBotConfig{In: strings.NewReader(""), Out: out, BotName: "helper"})
+			call := tt.call
+
+			if call == nil {
+				call = func(bot *bots.ConsoleBot, activity *bots.Activity) error {
+					_, err := bot.Send(activity)
+					return err
+				}
+			}
+
+			if err := call(bot, tt.activity); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.String(); got != tt.want {
+				t.Fatalf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsoleBotContextCancel(t *testing.T) {
+	in, writer := io.Pipe()
+	defer writer.Close()
+	bot := bots.NewConsoleBot(&bots.ConsoleBotConfig{In: in, Out: &bytes.Buffer{}})
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := bot.GetUpdatesChannelContext(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case activity := <-updates:
+		if activity.Type != bots.TypeConversationUpdate {
+			t.Fatalf("unexpected activity %+v", activity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no conversation update")
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("unexpected activity after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("updates channel was not closed")
+	}
+}
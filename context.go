@@ -0,0 +1,87 @@
+package bots
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextAdapter struct {
+	Bot
+}
+
+func contextBot(bot Bot) ContextBot {
+	if b, ok := bot.(ContextBot); ok {
+		return b
+	}
+
+	return &contextAdapter{Bot: bot}
+}
+
+func (b *contextAdapter) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return b.Send(activity)
+}
+
+func (b *contextAdapter) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return b.Update(activity)
+}
+
+func (b *contextAdapter) DeleteContext(ctx context.Context, activity *Activity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.Delete(activity)
+}
+
+func (b *contextAdapter) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	updates, err := b.GetUpdatesChannel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return forwardUpdates(ctx, updates), nil
+}
+
+func (b *contextAdapter) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return b.GetFile(attachment, activity)
+}
+
+func forwardUpdates(ctx context.Context, updates <-chan *Activity) <-chan *Activity {
+	result := make(chan *Activity)
+
+	go func() {
+		defer close(result)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-updates:
+				if !ok {
+					return
+				}
+
+				select {
+				case result <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return result
+}
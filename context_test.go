@@ -0,0 +1,176 @@
+package bots_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/msbottest"
+	"github.com/nickalie/bots/vibertest"
+)
+
+// hangingServer accepts requests and holds them until the client gives up.
+func hangingServer(t *testing.T) (*httptest.Server, <-chan struct{}) {
+	entered := make(chan struct{})
+	once := sync.Once{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices a closed connection only after the body is read.
+		ioutil.ReadAll(r.Body)
+		once.Do(func() { close(entered) })
+		<-r.Context().Done()
+	}))
+
+	t.Cleanup(server.Close)
+	return server, entered
+}
+
+func TestSendContextCancel(t *testing.T) {
+	connector, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer connector.Close()
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, url string) (bots.ContextBot, *bots.Activity)
+	}{
+		{"ms", func(t *testing.T, url string) (bots.ContextBot, *bots.Activity) {
+			bot := bots.NewMSBot(connector.Settings())
+			t.Cleanup(func() { bot.Close() })
+			activity := connector.NewActivity("hi").Response("hello")
+			activity.ServiceUrl = url
+			return bot, activity
+		}},
+		{"viber", func(t *testing.T, url string) (bots.ContextBot, *bots.Activity) {
+			return viberBot(t, url), viberActivity()
+		}},
+		{"multi", func(t *testing.T, url string) (bots.ContextBot, *bots.Activity) {
+			return bots.NewMultiBot(viberBot(t, url)), viberActivity()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, entered := hangingServer(t)
+			bot, activity := tt.setup(t, server.URL)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			result := make(chan error, 1)
+
+			go func() {
+				_, err := bot.SendContext(ctx, activity)
+				result <- err
+			}()
+
+			select {
+			case <-entered:
+			case err := <-result:
+				t.Fatalf("SendContext returned %v before reaching the server", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("request did not reach the server")
+			}
+
+			cancel()
+
+			select {
+			case err := <-result:
+				if !errors.Is(err, context.Canceled) {
+					t.Fatalf("SendContext = %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("SendContext was not aborted by the cancelled context")
+			}
+		})
+	}
+}
+
+func TestGetUpdatesChannelContextCloses(t *testing.T) {
+	connector, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer connector.Close()
+	viber := vibertest.NewServer("token")
+	defer viber.Close()
+
+	newViber := func(t *testing.T) bots.Bot {
+		bot, err := bots.NewViberBot(viber.Config("https://example.com/viber"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return bot
+	}
+
+	tests := []struct {
+		name string
+		bot  func(t *testing.T) bots.ContextBot
+	}{
+		{"ms", func(t *testing.T) bots.ContextBot {
+			bot := bots.NewMSBot(connector.Settings())
+			t.Cleanup(func() { bot.Close() })
+			return bot
+		}},
+		{"viber", func(t *testing.T) bots.ContextBot {
+			return newViber(t).(bots.ContextBot)
+		}},
+		{"multi", func(t *testing.T) bots.ContextBot {
+			return bots.NewMultiBot(newViber(t), bots.NewMSBot(connector.Settings()))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			updates, err := tt.bot(t).GetUpdatesChannelContext(ctx)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cancel()
+
+			select {
+			case _, ok := <-updates:
+				if ok {
+					t.Fatal("unexpected activity after cancel")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("updates channel was not closed")
+			}
+		})
+	}
+}
+
+func viberBot(t *testing.T, url string) *bots.ViberBot {
+	bot, err := bots.NewViberBot(&bots.ViberBotConfig{Token: "token", APIEndpoint: url, Retry: &bots.RetryPolicy{}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bot
+}
+
+func viberActivity() *bots.Activity {
+	return &bots.Activity{
+		Type:         bots.TypeMessage,
+		ChannelId:    bots.ChannelViber,
+		Text:         "hello",
+		Recipient:    &bots.ChannelAccount{Identification: bots.Identification{Id: "U1"}},
+		Conversation: &bots.ConversationAccount{ChannelAccount: bots.ChannelAccount{Identification: bots.Identification{Id: "U1"}}},
+	}
+}
@@ -0,0 +1,238 @@
+package bots_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/msbottest"
+)
+
+func TestClientCredentials(t *testing.T) {
+	server, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		secret string
+		ok     bool
+	}{
+		{"valid", "password", true},
+		{"wrong secret", "other", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.Reset()
+			source := &bots.ClientCredentials{
+				TokenURL:     server.URL + "/oauth2/token",
+				ClientId:     "app",
+				ClientSecret: tt.secret,
+				Scope:        server.URL + "/.default",
+			}
+
+			token, err := source.Token(context.Background())
+
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %v", err, tt.ok)
+			}
+
+			if tt.ok && (token.AccessToken == "" || time.Until(token.Expiry) < 50*time.Minute) {
+				t.Fatalf("unexpected token %+v", token)
+			}
+
+			requests := server.TokenRequests()
+
+			if len(requests) != 1 || requests[0].ContentType != "multipart/form-data" || requests[0].Scope != source.Scope {
+				t.Fatalf("unexpected token requests %+v", requests)
+			}
+		})
+	}
+}
+
+func TestMSBotRenewsRejectedToken(t *testing.T) {
+	server, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+	bot := bots.NewMSBot(server.Settings())
+	defer bot.Close()
+	activity := server.NewActivity("hi").Response("hello")
+
+	if _, err = bot.Send(activity); err != nil {
+		t.Fatal(err)
+	}
+
+	server.RevokeTokens()
+
+	if _, err = bot.Send(activity); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests := server.TokenRequests(); len(requests) != 2 {
+		t.Fatalf("got %d token requests, want 2", len(requests))
+	}
+
+	calls := server.Calls()
+
+	if len(calls) != 2 || calls[0].Method != http.MethodPost || calls[0].Authorization == calls[1].Authorization {
+		t.Fatalf("unexpected connector calls %+v", calls)
+	}
+}
+
+func TestCertificateCredentials(t *testing.T) {
+	server, err := msbottest.NewServer("app", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+	other, otherKey, err := server.IssueCertificate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, key, err := server.IssueCertificate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		certificate *x509.Certificate
+		key         *rsa.PrivateKey
+		ok          bool
+	}{
+		{"registered certificate", certificate, key, true},
+		{"unknown certificate", other, otherKey, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.Reset()
+			settings := server.Settings()
+			settings.AppPassword = ""
+			settings.Certificate = tt.certificate
+			settings.PrivateKey = tt.key
+			bot := bots.NewMSBot(settings)
+			defer bot.Close()
+			_, err := bot.Send(server.NewActivity("hi").Response("hello"))
+
+			if (err == nil) != tt.ok {
+				t.Fatalf("err = %v, want ok = %v", err, tt.ok)
+			}
+
+			requests := server.TokenRequests()
+
+			if len(requests) != 1 {
+				t.Fatalf("got %d token requests, want 1", len(requests))
+			}
+
+			request := requests[0]
+
+			if request.ContentType != "application/x-www-form-urlencoded" || request.ClientId != "app" ||
+				request.AssertionType != "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+				t.Fatalf("unexpected token request %+v", request)
+			}
+
+			assertion, _, err := new(jwt.Parser).ParseUnverified(request.Assertion, jwt.MapClaims{})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			thumbprint := sha1.Sum(tt.certificate.Raw)
+
+			if assertion.Header["alg"] != "RS256" || assertion.Header["x5t"] != base64.RawURLEncoding.EncodeToString(thumbprint[:]) {
+				t.Errorf("unexpected assertion header %v", assertion.Header)
+			}
+
+			claims := assertion.Claims.(jwt.MapClaims)
+
+			if claims["aud"] != server.URL+"/oauth2/token" || claims["iss"] != "app" || claims["sub"] != "app" || claims["jti"] == "" {
+				t.Errorf("unexpected assertion claims %v", claims)
+			}
+
+			exp, _ := claims["exp"].(float64)
+
+			if lifetime := time.Until(time.Unix(int64(exp), 0)); lifetime <= 0 || lifetime > 10*time.Minute {
+				t.Errorf("assertion expires in %v", lifetime)
+			}
+		})
+	}
+}
+
+func TestNewMSBotSettingsErrors(t *testing.T) {
+	server, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+	certificate, _, err := server.IssueCertificate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings func(s *bots.MSBotSettings)
+		ok       bool
+	}{
+		{"valid", func(s *bots.MSBotSettings) {}, true},
+		{"single tenant", func(s *bots.MSBotSettings) { s.AppType, s.TenantId = bots.AppTypeSingleTenant, "tenant" }, true},
+		{"single tenant without tenant id", func(s *bots.MSBotSettings) { s.AppType = bots.AppTypeSingleTenant }, false},
+		{"unknown app type", func(s *bots.MSBotSettings) { s.AppType = "Other" }, false},
+		{"certificate without key", func(s *bots.MSBotSettings) { s.Certificate = certificate }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := server.Settings()
+			tt.settings(settings)
+			bot, err := bots.NewMSBotE(settings)
+
+			if (err == nil) != tt.ok || (bot != nil) != tt.ok {
+				t.Fatalf("NewMSBotE = %v, %v, want ok = %v", bot, err, tt.ok)
+			}
+
+			if bot != nil {
+				bot.Close()
+			}
+
+			settings = server.Settings()
+			tt.settings(settings)
+			bot = bots.NewMSBot(settings)
+			defer bot.Close()
+			_, sendErr := bot.Send(server.NewActivity("hi").Response("hello"))
+
+			if tt.ok {
+				return
+			}
+
+			if sendErr == nil || sendErr.Error() != err.Error() {
+				t.Fatalf("Send = %v, want %v", sendErr, err)
+			}
+		})
+	}
+}
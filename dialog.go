@@ -0,0 +1,200 @@
+package bots
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+const dialogStackKey = "dialogStack"
+
+type DialogStatus int
+
+const (
+	DialogEmpty DialogStatus = iota
+	DialogWaiting
+	DialogComplete
+	DialogCancelled
+)
+
+type DialogTurnResult struct {
+	Status DialogStatus
+	Result interface{}
+}
+
+type Dialog interface {
+	Id() string
+	Begin(dc *DialogContext, options interface{}) (*DialogTurnResult, error)
+	Continue(dc *DialogContext) (*DialogTurnResult, error)
+	Resume(dc *DialogContext, result interface{}) (*DialogTurnResult, error)
+}
+
+type DialogInstance struct {
+	Id    string                 `json:"id"`
+	State map[string]interface{} `json:"state"`
+}
+
+type DialogSet struct {
+	dialogs map[string]Dialog
+}
+
+func NewDialogSet(dialogs ...Dialog) *DialogSet {
+	s := &DialogSet{dialogs: make(map[string]Dialog)}
+
+	for _, d := range dialogs {
+		s.Add(d)
+	}
+
+	return s
+}
+
+func (s *DialogSet) Add(d Dialog) {
+	s.dialogs[d.Id()] = d
+}
+
+func (s *DialogSet) Find(id string) Dialog {
+	return s.dialogs[id]
+}
+
+func (s *DialogSet) CreateContext(t *Turn) (*DialogContext, error) {
+	if t.State == nil {
+		return nil, errors.New("dialogs require turn state, wrap the handler with BotState.Handler")
+	}
+
+	dc := &DialogContext{Turn: t, set: s}
+
+	if raw, ok := t.State.Conversation[dialogStackKey]; ok {
+		if err := decodeState(raw, &dc.stack); err != nil {
+			return nil, err
+		}
+	}
+
+	return dc, nil
+}
+
+func (s *DialogSet) Run(t *Turn, dialogId string, options interface{}) (*DialogTurnResult, error) {
+	dc, err := s.CreateContext(t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := dc.Continue()
+
+	if err != nil || result.Status != DialogEmpty {
+		return result, err
+	}
+
+	return dc.Begin(dialogId, options)
+}
+
+type DialogContext struct {
+	Turn  *Turn
+	set   *DialogSet
+	stack []*DialogInstance
+}
+
+func (dc *DialogContext) ActiveDialog() *DialogInstance {
+	if len(dc.stack) == 0 {
+		return nil
+	}
+
+	return dc.stack[len(dc.stack)-1]
+}
+
+func (dc *DialogContext) Begin(dialogId string, options interface{}) (*DialogTurnResult, error) {
+	d := dc.set.Find(dialogId)
+
+	if d == nil {
+		return nil, errors.New("dialog not found: " + dialogId)
+	}
+
+	dc.stack = append(dc.stack, &DialogInstance{Id: dialogId, State: make(map[string]interface{})})
+	dc.save()
+	return d.Begin(dc, options)
+}
+
+func (dc *DialogContext) Continue() (*DialogTurnResult, error) {
+	instance := dc.ActiveDialog()
+
+	if instance == nil {
+		return &DialogTurnResult{Status: DialogEmpty}, nil
+	}
+
+	d := dc.set.Find(instance.Id)
+
+	if d == nil {
+		return nil, errors.New("dialog not found: " + instance.Id)
+	}
+
+	return d.Continue(dc)
+}
+
+func (dc *DialogContext) End(result interface{}) (*DialogTurnResult, error) {
+	if len(dc.stack) > 0 {
+		dc.stack = dc.stack[:len(dc.stack)-1]
+	}
+
+	dc.save()
+	instance := dc.ActiveDialog()
+
+	if instance == nil {
+		return &DialogTurnResult{Status: DialogComplete, Result: result}, nil
+	}
+
+	d := dc.set.Find(instance.Id)
+
+	if d == nil {
+		return nil, errors.New("dialog not found: " + instance.Id)
+	}
+
+	return d.Resume(dc, result)
+}
+
+func (dc *DialogContext) Replace(dialogId string, options interface{}) (*DialogTurnResult, error) {
+	if len(dc.stack) > 0 {
+		dc.stack = dc.stack[:len(dc.stack)-1]
+	}
+
+	return dc.Begin(dialogId, options)
+}
+
+func (dc *DialogContext) CancelAll() *DialogTurnResult {
+	dc.stack = nil
+	dc.save()
+	return &DialogTurnResult{Status: DialogCancelled}
+}
+
+func (dc *DialogContext) Wait() (*DialogTurnResult, error) {
+	dc.save()
+	return &DialogTurnResult{Status: DialogWaiting}, nil
+}
+
+func (dc *DialogContext) save() {
+	if len(dc.stack) == 0 {
+		delete(dc.Turn.State.Conversation, dialogStackKey)
+		return
+	}
+
+	dc.Turn.State.Conversation[dialogStackKey] = dc.stack
+}
+
+func decodeState(value interface{}, target interface{}) error {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, target)
+}
+
+func stateInt(state map[string]interface{}, key string) int {
+	switch v := state[key].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+
+	return 0
+}
@@ -0,0 +1,243 @@
+package bots_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/bottest"
+)
+
+func orderDialogs() *bots.DialogSet {
+	quantity := bots.NewNumberPrompt("quantity")
+	quantity.Validator = func(t *bots.Turn, value interface{}) bool {
+		return value.(float64) > 0
+	}
+
+	age := bots.NewNumberPrompt("age")
+	age.MaxRetries = 1
+
+	return bots.NewDialogSet(
+		bots.NewTextPrompt("email"),
+		quantity,
+		bots.NewChoicePrompt("color"),
+		bots.NewConfirmPrompt("confirm"),
+		age,
+		bots.NewWaterfallDialog("order",
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				return step.Prompt("email", &bots.PromptOptions{Prompt: "What is your email?"})
+			},
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				step.Values["email"] = step.Result
+				return step.Prompt("quantity", &bots.PromptOptions{
+					Prompt:      "How many?",
+					RetryPrompt: "Please enter a number above zero.",
+				})
+			},
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				step.Values["quantity"] = step.Result
+				return step.Prompt("color", &bots.PromptOptions{Prompt: "Which color?", Choices: []string{"Red", "Blue"}})
+			},
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				step.Values["color"] = step.Result
+				return step.Prompt("confirm", &bots.PromptOptions{
+					Prompt: fmt.Sprintf("Order %v %v to %v?", step.Values["quantity"], step.Result, step.Values["email"]),
+				})
+			},
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				if step.Result != true {
+					return step.End("Order dropped")
+				}
+
+				return step.End(fmt.Sprintf("Ordered %v %v for %v", step.Values["quantity"], step.Values["color"], step.Values["email"]))
+			},
+		),
+		bots.NewWaterfallDialog("survey",
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				return step.Prompt("age", &bots.PromptOptions{Prompt: "How old are you?"})
+			},
+			func(step *bots.WaterfallStep) (*bots.DialogTurnResult, error) {
+				if step.Result == nil {
+					return step.End("Giving up")
+				}
+
+				return step.End(fmt.Sprintf("You are %v", step.Result))
+			},
+		),
+	)
+}
+
+// runDialogs serves the dialog through a dispatcher and BotState until the
+// returned function stops it.
+func runDialogs(t *testing.T, fake *bottest.Bot, storage bots.Storage, dialogId string) func() {
+	dialogs := orderDialogs()
+	state := bots.NewBotState(storage)
+	state.HandleError(func(turn *bots.Turn, err error) { t.Error(err) })
+	d := bots.NewDispatcher(fake, 1)
+	d.HandleDefault(state.Handler(func(turn *bots.Turn) {
+		if turn.Activity.Text == "cancel" {
+			dc, err := dialogs.CreateContext(turn)
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			dc.CancelAll()
+			turn.Reply("Cancelled")
+			return
+		}
+
+		result, err := dialogs.Run(turn, dialogId, nil)
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if result.Status == bots.DialogComplete {
+			turn.Reply(result.Result.(string))
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- d.Run(ctx)
+	}()
+
+	return func() {
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("dispatcher did not stop")
+		}
+	}
+}
+
+func TestWaterfallDialog(t *testing.T) {
+	fake := bottest.NewBot()
+	stop := runDialogs(t, fake, bots.NewMemoryStorage(), "order")
+	defer stop()
+
+	bottest.RunTranscript(t, fake, bottest.Transcript{
+		bottest.UserSays("hi"),
+		bottest.BotReplies("What is your email?"),
+		bottest.UserSays("  "),
+		bottest.BotReplies("What is your email?"),
+		bottest.UserSays("a@example.com"),
+		bottest.BotReplies("How many?"),
+		bottest.UserSays("lots"),
+		bottest.BotReplies("Please enter a number above zero."),
+		bottest.UserSays("-1"),
+		bottest.BotReplies("Please enter a number above zero."),
+		bottest.UserSays("2"),
+		bottest.BotRepliesWith(func(t testing.TB, activity *bots.Activity) {
+			bottest.AssertText(t, activity, "Which color?")
+			bottest.AssertSuggestedActions(t, activity, "Red", "Blue")
+		}),
+		bottest.UserSays("green"),
+		bottest.BotReplies("Which color?"),
+		bottest.UserSays("2"),
+		bottest.BotRepliesWith(func(t testing.TB, activity *bots.Activity) {
+			bottest.AssertText(t, activity, "Order 2 Blue to a@example.com?")
+			bottest.AssertSuggestedActions(t, activity, "Yes", "No")
+		}),
+		bottest.UserSays("maybe"),
+		bottest.BotReplies("Order 2 Blue to a@example.com?"),
+		bottest.UserSays("yes"),
+		bottest.BotReplies("Ordered 2 Blue for a@example.com"),
+		bottest.UserSays("again"),
+		bottest.BotReplies("What is your email?"),
+		bottest.UserSays("cancel"),
+		bottest.BotReplies("Cancelled"),
+		bottest.UserSays("hello"),
+		bottest.BotReplies("What is your email?"),
+	})
+}
+
+func TestPromptMaxRetries(t *testing.T) {
+	fake := bottest.NewBot()
+	stop := runDialogs(t, fake, bots.NewMemoryStorage(), "survey")
+	defer stop()
+
+	bottest.RunTranscript(t, fake, bottest.Transcript{
+		bottest.UserSays("hi"),
+		bottest.BotReplies("How old are you?"),
+		bottest.UserSays("old"),
+		bottest.BotReplies("How old are you?"),
+		bottest.UserSays("very old"),
+		bottest.BotReplies("Giving up"),
+		bottest.UserSays("hi"),
+		bottest.BotReplies("How old are you?"),
+		bottest.UserSays("42"),
+		bottest.BotReplies("You are 42"),
+	})
+}
+
+func TestDialogStateSurvivesRestart(t *testing.T) {
+	fake := bottest.NewBot()
+	storage := bots.NewMemoryStorage()
+	stop := runDialogs(t, fake, storage, "order")
+
+	bottest.RunTranscript(t, fake, bottest.Transcript{
+		bottest.UserSays("hi"),
+		bottest.BotReplies("What is your email?"),
+		bottest.UserSays("a@example.com"),
+		bottest.BotReplies("How many?"),
+		bottest.UserSays("3"),
+		bottest.BotReplies("Which color?"),
+	})
+
+	stop()
+	item, err := storage.Read(context.Background(), bots.ConversationStateKey(fake.NewActivity(bots.TypeMessage, "")))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data := string(item.Data); !strings.Contains(data, "dialogStack") || !strings.Contains(data, "a@example.com") {
+		t.Fatalf("conversation state does not hold the dialog stack: %s", data)
+	}
+
+	stop = runDialogs(t, fake, storage, "order")
+	defer stop()
+
+	bottest.RunTranscript(t, fake, bottest.Transcript{
+		bottest.UserSays("red"),
+		bottest.BotReplies("Order 3 Red to a@example.com?"),
+		bottest.UserSays("no"),
+		bottest.BotReplies("Order dropped"),
+	})
+}
+
+func TestDialogRequiresState(t *testing.T) {
+	fake := bottest.NewBot()
+	d := bots.NewDispatcher(fake, 1)
+	var err error
+	d.HandleDefault(func(turn *bots.Turn) {
+		_, err = orderDialogs().Run(turn, "order", nil)
+	})
+	d.Dispatch(context.Background(), fake.NewActivity(bots.TypeMessage, "hi"))
+
+	if err == nil {
+		t.Fatal("expected an error without turn state")
+	}
+
+	turn := stateTurn(stateActivity())
+	turn.State, err = bots.NewBotState(bots.NewMemoryStorage()).Load(context.Background(), turn.Activity)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = bots.NewDialogSet().Run(turn, "missing", nil); err == nil {
+		t.Fatal("expected an error for an unknown dialog")
+	}
+}
@@ -0,0 +1,491 @@
+package bots
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+const discordAPI = "https://discord.com/api/v10"
+
+const (
+	discordPing               = 1
+	discordApplicationCommand = 2
+	discordMessageComponent   = 3
+
+	discordPong                     = 1
+	discordDeferredChannelMessage   = 5
+	discordDeferredUpdateMessage    = 6
+	discordInteractionTokenLifetime = 15 * time.Minute
+)
+
+var discordChannels = []string{ChannelDiscord}
+
+type DiscordBotConfig struct {
+	ApplicationId string
+	PublicKey     string
+	Token         string
+	APIEndpoint   string
+}
+
+type DiscordBot struct {
+	config       *DiscordBotConfig
+	publicKey    ed25519.PublicKey
+	updates      chan *Activity
+	lifecycle    *lifecycle
+	mu           sync.Mutex
+	interactions map[string]*discordInteractionToken
+}
+
+type discordInteractionToken struct {
+	token    string
+	expires  time.Time
+	original bool
+}
+
+func NewDiscordBot(config *DiscordBotConfig) (*DiscordBot, error) {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = discordAPI
+	}
+
+	publicKey, err := hex.DecodeString(config.PublicKey)
+
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid discord public key")
+	}
+
+	return &DiscordBot{
+		config:       config,
+		publicKey:    publicKey,
+		updates:      make(chan *Activity),
+		lifecycle:    newLifecycle(),
+		interactions: make(map[string]*discordInteractionToken),
+	}, nil
+}
+
+func (b *DiscordBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		errorResponse(w, "unable to read body")
+		return
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	timestamp := r.Header.Get("X-Signature-Timestamp")
+
+	if err != nil || !ed25519.Verify(b.publicKey, append([]byte(timestamp), body...), signature) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	interaction := &discordInteraction{}
+
+	if err = json.Unmarshal(body, interaction); err != nil {
+		errorResponse(w, "invalid interaction")
+		return
+	}
+
+	var responseType int
+
+	switch interaction.Type {
+	case discordPing:
+		writeJSON(w, map[string]int{"type": discordPong})
+		return
+	case discordApplicationCommand:
+		responseType = discordDeferredChannelMessage
+	case discordMessageComponent:
+		responseType = discordDeferredUpdateMessage
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+	b.storeInteraction(interaction.Id, interaction.Token, responseType == discordDeferredChannelMessage)
+	writeJSON(w, map[string]int{"type": responseType})
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	b.lifecycle.deliver(b.updates, discordToActivity(interaction))
+}
+
+func (b *DiscordBot) storeInteraction(id, token string, original bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+
+	for k, v := range b.interactions {
+		if now.After(v.expires) {
+			delete(b.interactions, k)
+		}
+	}
+
+	b.interactions[id] = &discordInteractionToken{
+		token:    token,
+		expires:  now.Add(discordInteractionTokenLifetime),
+		original: original,
+	}
+}
+
+func (b *DiscordBot) interactionToken(id string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.interactions[id]
+
+	if !ok || time.Now().After(t.expires) {
+		return "", false
+	}
+
+	original := t.original
+	t.original = false
+	return t.token, original
+}
+
+func (b *DiscordBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.updates, nil
+}
+
+func (b *DiscordBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	return forwardUpdates(ctx, b.updates), nil
+}
+
+func (b *DiscordBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *DiscordBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	channel := targetConversationId(activity)
+
+	if activity.Type == TypeTyping {
+		return nil, b.call(ctx, http.MethodPost, "/channels/"+channel+"/typing", nil, nil)
+	}
+
+	message := discordMessage(activity)
+	result := &discordMessageResponse{}
+	var err error
+
+	if token, original := b.interactionToken(activity.ReplyToId); token != "" {
+		if original {
+			err = b.call(ctx, http.MethodPatch, b.webhookPath(token)+"/messages/@original", message, result)
+		} else {
+			err = b.call(ctx, http.MethodPost, b.webhookPath(token), message, result)
+		}
+	} else {
+		err = b.call(ctx, http.MethodPost, "/channels/"+channel+"/messages", message, result)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identification{Id: result.Id}, nil
+}
+
+func (b *DiscordBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *DiscordBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	message := discordMessage(activity)
+	result := &discordMessageResponse{}
+	var err error
+
+	if token := b.followupToken(activity.ReplyToId); token != "" {
+		err = b.call(ctx, http.MethodPatch, b.webhookPath(token)+"/messages/"+activity.Id, message, result)
+	} else {
+		err = b.call(ctx, http.MethodPatch, "/channels/"+targetConversationId(activity)+"/messages/"+activity.Id, message, result)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identification{Id: result.Id}, nil
+}
+
+func (b *DiscordBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *DiscordBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	if token := b.followupToken(activity.ReplyToId); token != "" {
+		return b.call(ctx, http.MethodDelete, b.webhookPath(token)+"/messages/"+activity.Id, nil, nil)
+	}
+
+	return b.call(ctx, http.MethodDelete, "/channels/"+targetConversationId(activity)+"/messages/"+activity.Id, nil, nil)
+}
+
+func (b *DiscordBot) followupToken(id string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t, ok := b.interactions[id]; ok && time.Now().Before(t.expires) {
+		return t.token
+	}
+
+	return ""
+}
+
+func (b *DiscordBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *DiscordBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, attachment.ContentUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func (b *DiscordBot) GetChannels() []string {
+	return discordChannels
+}
+
+func (b *DiscordBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *DiscordBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *DiscordBot) webhookPath(token string) string {
+	return "/webhooks/" + b.config.ApplicationId + "/" + token
+}
+
+func (b *DiscordBot) call(ctx context.Context, method, path string, payload interface{}, result interface{}) error {
+	request := gorequest.New()
+	url := b.config.APIEndpoint + path
+
+	switch method {
+	case http.MethodPatch:
+		request.Patch(url)
+	case http.MethodDelete:
+		request.Delete(url)
+	default:
+		request.Post(url)
+	}
+
+	request.Set("Authorization", "Bot "+b.config.Token)
+
+	if payload != nil {
+		request.Send(payload)
+	}
+
+	resp, body, err := endRequest(ctx, request)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return errors.New(fmt.Sprintf("discord %s %s failed: %s %d", method, path, body, resp.StatusCode))
+	}
+
+	if result == nil || len(body) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+type discordUser struct {
+	Id         string `json:"id"`
+	Username   string `json:"username"`
+	GlobalName string `json:"global_name"`
+}
+
+type discordOption struct {
+	Name    string           `json:"name"`
+	Type    int              `json:"type"`
+	Value   interface{}      `json:"value"`
+	Options []*discordOption `json:"options"`
+}
+
+type discordInteraction struct {
+	Id        string `json:"id"`
+	Type      int    `json:"type"`
+	Token     string `json:"token"`
+	GuildId   string `json:"guild_id"`
+	ChannelId string `json:"channel_id"`
+	Data      struct {
+		Name     string           `json:"name"`
+		Options  []*discordOption `json:"options"`
+		CustomId string           `json:"custom_id"`
+		Values   []string         `json:"values"`
+	} `json:"data"`
+	Member *struct {
+		User *discordUser `json:"user"`
+	} `json:"member"`
+	User    *discordUser `json:"user"`
+	Message *struct {
+		Id string `json:"id"`
+	} `json:"message"`
+}
+
+type discordMessageResponse struct {
+	Id string `json:"id"`
+}
+
+func discordToActivity(i *discordInteraction) *Activity {
+	result := &Activity{}
+	result.Id = i.Id
+	result.ChannelId = ChannelDiscord
+	result.Conversation = &ConversationAccount{
+		ChannelAccount: ChannelAccount{Identification: Identification{Id: i.ChannelId}},
+		IsGroup:        i.GuildId != "",
+	}
+
+	user := i.User
+
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+
+	if user != nil {
+		name := user.GlobalName
+
+		if name == "" {
+			name = user.Username
+		}
+
+		result.From = &ChannelAccount{Identification: Identification{Id: user.Id}, Name: name}
+	}
+
+	if i.Type == discordApplicationCommand {
+		result.Type = TypeEvent
+		result.Name = i.Data.Name
+		values := make(map[string]interface{})
+		parts := []string{"/" + i.Data.Name}
+		options := i.Data.Options
+
+		for len(options) == 1 && len(options[0].Options) > 0 {
+			parts = append(parts, options[0].Name)
+			options = options[0].Options
+		}
+
+		for _, o := range options {
+			values[o.Name] = o.Value
+
+			if o.Value != nil {
+				parts = append(parts, fmt.Sprint(o.Value))
+			} else {
+				parts = append(parts, o.Name)
+			}
+		}
+
+		result.Value = values
+		result.Text = strings.Join(parts, " ")
+		return result
+	}
+
+	result.Type = TypeMessage
+	result.Text = i.Data.CustomId
+
+	if len(i.Data.Values) > 0 {
+		result.Text = strings.Join(i.Data.Values, ",")
+		result.Value = i.Data.Values
+	}
+
+	return result
+}
+
+func discordMessage(activity *Activity) map[string]interface{} {
+	message := map[string]interface{}{"content": activity.Text}
+	var embeds []map[string]interface{}
+	var actions []*CardAction
+
+	for _, a := range activity.Attachments {
+		if a.ContentType == TypeHeroCard {
+			card, ok := a.Content.(*HeroCard)
+
+			if !ok {
+				continue
+			}
+
+			embed := map[string]interface{}{"title": card.Title, "description": card.Text}
+
+			if len(card.Images) > 0 {
+				embed["image"] = map[string]string{"url": card.Images[0].Url}
+			}
+
+			embeds = append(embeds, embed)
+			actions = append(actions, card.Buttons...)
+		} else if a.ContentUrl != "" {
+			embeds = append(embeds, map[string]interface{}{"title": a.Name, "image": map[string]string{"url": a.ContentUrl}})
+		}
+	}
+
+	if activity.SuggestedActions != nil {
+		actions = append(actions, activity.SuggestedActions.Actions...)
+	}
+
+	if len(embeds) > 0 {
+		message["embeds"] = embeds
+	}
+
+	if len(actions) > 0 {
+		message["components"] = discordComponents(actions)
+	}
+
+	return message
+}
+
+func discordComponents(actions []*CardAction) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0)
+	var buttons []map[string]interface{}
+
+	for _, action := range actions {
+		button := map[string]interface{}{"type": 2, "label": action.Title}
+
+		if action.Type == TypeOpenUrl {
+			button["style"] = 5
+			button["url"] = action.Value
+		} else {
+			button["style"] = 1
+			button["custom_id"] = action.Value
+		}
+
+		buttons = append(buttons, button)
+
+		if len(buttons) == 5 {
+			rows = append(rows, map[string]interface{}{"type": 1, "components": buttons})
+			buttons = nil
+		}
+	}
+
+	if len(buttons) > 0 {
+		rows = append(rows, map[string]interface{}{"type": 1, "components": buttons})
+	}
+
+	return rows
+}
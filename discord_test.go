@@ -0,0 +1,129 @@
+package bots
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiscordSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherPrivate, _ := ed25519.GenerateKey(nil)
+	body := `{"id":"1","type":2,"token":"tok","channel_id":"C1","data":{"name":"ping"},"user":{"id":"U1","username":"user"}}`
+	sign := func(key ed25519.PrivateKey, timestamp, body string) string {
+		return hex.EncodeToString(ed25519.Sign(key, []byte(timestamp+body)))
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		timestamp string
+		signature string
+		status    int
+		response  string
+	}{
+		{"valid", body, "1000", sign(private, "1000", body), http.StatusOK, `{"type":5}`},
+		{"ping", `{"type":1}`, "1000", sign(private, "1000", `{"type":1}`), http.StatusOK, `{"type":1}`},
+		{"tampered body", strings.Replace(body, "ping", "pong", 1), "1000", sign(private, "1000", body), http.StatusUnauthorized, ""},
+		{"tampered timestamp", body, "2000", sign(private, "1000", body), http.StatusUnauthorized, ""},
+		{"wrong key", body, "1000", sign(otherPrivate, "1000", body), http.StatusUnauthorized, ""},
+		{"malformed signature", body, "1000", "zz", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, err := NewDiscordBot(&DiscordBotConfig{PublicKey: hex.EncodeToString(public)})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/discord", strings.NewReader(tt.body))
+			r.Header.Set("X-Signature-Ed25519", tt.signature)
+			r.Header.Set("X-Signature-Timestamp", tt.timestamp)
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if got := strings.TrimSpace(w.Body.String()); got != tt.response {
+				t.Fatalf("response = %q, want %q", got, tt.response)
+			}
+
+			if tt.name == "valid" && (activity == nil || activity.Name != "ping") {
+				t.Fatalf("unexpected activity %+v", activity)
+			} else if tt.name != "valid" && activity != nil {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+		})
+	}
+}
+
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan struct{}
+}
+
+func (r *flushRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	close(r.flushed)
+}
+
+func TestDiscordAcknowledgesBeforeDelivery(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	bot, _ := NewDiscordBot(&DiscordBotConfig{PublicKey: hex.EncodeToString(public)})
+	body := `{"id":"1","type":2,"token":"tok","channel_id":"C1","data":{"name":"ping"}}`
+	r := httptest.NewRequest(http.MethodPost, "/discord", strings.NewReader(body))
+	r.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(private, []byte("1000"+body))))
+	r.Header.Set("X-Signature-Timestamp", "1000")
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan struct{})}
+	served := make(chan struct{})
+
+	go func() {
+		bot.ServeHTTP(w, r)
+		close(served)
+	}()
+
+	select {
+	case <-w.flushed:
+	case <-time.After(time.Second):
+		t.Fatal("interaction was not acknowledged while the handler was busy")
+	}
+
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"type":5}` {
+		t.Fatalf("got %d %q, want deferred acknowledgement", w.Code, w.Body.String())
+	}
+
+	if activity := <-bot.updates; activity.Name != "ping" {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	<-served
+}
+
+func TestDiscordRejectsWhenShuttingDown(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	bot, _ := NewDiscordBot(&DiscordBotConfig{PublicKey: hex.EncodeToString(public)})
+	bot.Shutdown(context.Background())
+	body := `{"id":"1","type":2,"token":"tok","channel_id":"C1","data":{"name":"ping"}}`
+	r := httptest.NewRequest(http.MethodPost, "/discord", strings.NewReader(body))
+	r.Header.Set("X-Signature-Ed25519", hex.EncodeToString(ed25519.Sign(private, []byte("1000"+body))))
+	r.Header.Set("X-Signature-Timestamp", "1000")
+	w := httptest.NewRecorder()
+	bot.ServeHTTP(w, r)
+
+	if w.Code != http.StatusServiceUnavailable || w.Body.Len() > 0 {
+		t.Fatalf("got %d %q, want %d without acknowledgement", w.Code, w.Body.String(), http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,209 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+type HandlerFunc func(t *Turn)
+
+type ErrorHandlerFunc func(t *Turn, err error)
+
+type Turn struct {
+	Bot      Bot
+	Activity *Activity
+	Matches  []string
+	State    *State
+	ctx      context.Context
+}
+
+func (t *Turn) Context() context.Context {
+	return t.ctx
+}
+
+func (t *Turn) Reply(message string) (*Identification, error) {
+	return t.Send(t.Activity.Response(message))
+}
+
+func (t *Turn) Send(activity *Activity) (*Identification, error) {
+	return contextBot(t.Bot).SendContext(t.ctx, activity)
+}
+
+func (t *Turn) Update(activity *Activity) (*Identification, error) {
+	return contextBot(t.Bot).UpdateContext(t.ctx, activity)
+}
+
+func (t *Turn) Delete(activity *Activity) error {
+	return contextBot(t.Bot).DeleteContext(t.ctx, activity)
+}
+
+type route struct {
+	activityType ActivityType
+	match        func(text string) []string
+	handler      HandlerFunc
+}
+
+type Dispatcher struct {
+	bot            Bot
+	workers        int
+	mu             sync.RWMutex
+	routes         []*route
+	defaultHandler HandlerFunc
+	errorHandler   ErrorHandlerFunc
+}
+
+func NewDispatcher(bot Bot, workers int) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &Dispatcher{bot: bot, workers: workers}
+}
+
+func (d *Dispatcher) Handle(activityType ActivityType, handler HandlerFunc) {
+	d.addRoute(&route{activityType: activityType, handler: handler})
+}
+
+func (d *Dispatcher) HandleText(text string, handler HandlerFunc) {
+	d.addRoute(&route{
+		activityType: TypeMessage,
+		match: func(s string) []string {
+			if strings.EqualFold(strings.TrimSpace(s), text) {
+				return []string{s}
+			}
+
+			return nil
+		},
+		handler: handler,
+	})
+}
+
+func (d *Dispatcher) HandlePattern(pattern string, handler HandlerFunc) {
+	d.HandleRegexp(regexp.MustCompile(pattern), handler)
+}
+
+func (d *Dispatcher) HandleRegexp(re *regexp.Regexp, handler HandlerFunc) {
+	d.addRoute(&route{
+		activityType: TypeMessage,
+		match:        re.FindStringSubmatch,
+		handler:      handler,
+	})
+}
+
+func (d *Dispatcher) HandleCommand(command string, handler HandlerFunc) {
+	d.addRoute(&route{
+		activityType: TypeMessage,
+		match: func(s string) []string {
+			s = strings.TrimSpace(s)
+
+			if s == command {
+				return []string{command, ""}
+			}
+
+			if strings.HasPrefix(s, command+" ") {
+				return []string{command, strings.TrimSpace(s[len(command):])}
+			}
+
+			return nil
+		},
+		handler: handler,
+	})
+}
+
+func (d *Dispatcher) HandleDefault(handler HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.defaultHandler = handler
+}
+
+func (d *Dispatcher) HandleError(handler ErrorHandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errorHandler = handler
+}
+
+func (d *Dispatcher) addRoute(r *route) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.routes = append(d.routes, r)
+}
+
+func (d *Dispatcher) Run(ctx context.Context) error {
+	updates, err := contextBot(d.bot).GetUpdatesChannelContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for activity := range updates {
+				d.Dispatch(ctx, activity)
+			}
+		}()
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (d *Dispatcher) Dispatch(ctx context.Context, activity *Activity) {
+	handler, matches := d.findHandler(activity)
+
+	if handler == nil {
+		return
+	}
+
+	turn := &Turn{Bot: d.bot, Activity: activity, Matches: matches, ctx: ctx}
+
+	defer func() {
+		if r := recover(); r != nil {
+			d.handleError(turn, errors.New(fmt.Sprintf("dispatcher: handler panic: %v", r)))
+		}
+	}()
+
+	handler(turn)
+}
+
+func (d *Dispatcher) handleError(t *Turn, err error) {
+	d.mu.RLock()
+	errorHandler := d.errorHandler
+	d.mu.RUnlock()
+
+	if errorHandler != nil {
+		errorHandler(t, err)
+	}
+}
+
+func (d *Dispatcher) findHandler(activity *Activity) (HandlerFunc, []string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, r := range d.routes {
+		if r.activityType != activity.Type || r.match == nil {
+			continue
+		}
+
+		if matches := r.match(activity.Text); matches != nil {
+			return r.handler, matches
+		}
+	}
+
+	for _, r := range d.routes {
+		if r.activityType == activity.Type && r.match == nil {
+			return r.handler, nil
+		}
+	}
+
+	return d.defaultHandler, nil
+}
@@ -0,0 +1,136 @@
+package bots_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/bottest"
+)
+
+func TestDispatcherRouting(t *testing.T) {
+	bot := bottest.NewBot()
+	d := bots.NewDispatcher(bot, 1)
+	var got string
+	var matches []string
+	route := func(name string) bots.HandlerFunc {
+		return func(t *bots.Turn) {
+			got = name
+			matches = t.Matches
+		}
+	}
+
+	d.HandleCommand("/start", route("command"))
+	d.HandleText("hello", route("text"))
+	d.HandlePattern(`^order (\d+)$`, route("pattern"))
+	d.HandleText("order 1", route("shadowed"))
+	d.Handle(bots.TypeMessage, route("message"))
+	d.Handle(bots.TypeConversationUpdate, route("update"))
+	d.HandleDefault(route("default"))
+
+	tests := []struct {
+		name         string
+		activityType bots.ActivityType
+		text         string
+		route        string
+		matches      []string
+	}{
+		{"command", bots.TypeMessage, "/start", "command", []string{"/start", ""}},
+		{"command with argument", bots.TypeMessage, "  /start  now please ", "command", []string{"/start", "now please"}},
+		{"command prefix", bots.TypeMessage, "/started", "message", nil},
+		{"text ignores case and space", bots.TypeMessage, " HeLLo ", "text", []string{" HeLLo "}},
+		{"pattern", bots.TypeMessage, "order 42", "pattern", []string{"order 42", "42"}},
+		{"earlier route wins", bots.TypeMessage, "order 1", "pattern", []string{"order 1", "1"}},
+		{"type route", bots.TypeMessage, "anything", "message", nil},
+		{"other type", bots.TypeConversationUpdate, "hello", "update", nil},
+		{"default", bots.TypeTyping, "", "default", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, matches = "", nil
+			d.Dispatch(context.Background(), bot.NewActivity(tt.activityType, tt.text))
+
+			if got != tt.route {
+				t.Fatalf("route = %q, want %q", got, tt.route)
+			}
+
+			if strings.Join(matches, "|") != strings.Join(tt.matches, "|") || len(matches) != len(tt.matches) {
+				t.Fatalf("matches = %q, want %q", matches, tt.matches)
+			}
+		})
+	}
+}
+
+func TestDispatcherWithoutDefault(t *testing.T) {
+	bot := bottest.NewBot()
+	d := bots.NewDispatcher(bot, 1)
+	called := false
+	d.HandleText("hello", func(t *bots.Turn) { called = true })
+	d.Dispatch(context.Background(), bot.NewActivity(bots.TypeMessage, "bye"))
+
+	if called {
+		t.Fatal("unmatched activity was routed")
+	}
+}
+
+func TestDispatcherPanicRecovery(t *testing.T) {
+	bot := bottest.NewBot()
+	d := bots.NewDispatcher(bot, 1)
+	d.HandleDefault(func(t *bots.Turn) { panic("boom") })
+	d.Dispatch(context.Background(), bot.NewActivity(bots.TypeMessage, "hi"))
+
+	var turn *bots.Turn
+	var err error
+	d.HandleError(func(t *bots.Turn, e error) {
+		turn, err = t, e
+	})
+
+	activity := bot.NewActivity(bots.TypeMessage, "hi")
+	d.Dispatch(context.Background(), activity)
+
+	if err == nil || !strings.Contains(err.Error(), "boom") || turn.Activity != activity {
+		t.Fatalf("got %v for %+v, want the panic reported with its turn", err, turn)
+	}
+}
+
+func TestDispatcherRunWithMiddleware(t *testing.T) {
+	fake := bottest.NewBot()
+	bot := bots.NewMiddlewareBot(fake, &bots.MiddlewareFuncs{
+		InboundFunc: func(ctx context.Context, activity *bots.Activity, next func(activity *bots.Activity)) {
+			activity.Text = strings.ToLower(activity.Text)
+			next(activity)
+		},
+		OutboundFunc: func(ctx context.Context, activity *bots.Activity, next bots.OutboundFunc) (*bots.Identification, error) {
+			activity.Text += "!"
+			return next(ctx, activity)
+		},
+	})
+
+	d := bots.NewDispatcher(bot, 2)
+	d.HandleText("hello", func(t *bots.Turn) { t.Reply("hi") })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- d.Run(ctx)
+	}()
+
+	bottest.RunTranscript(t, fake, bottest.Transcript{
+		bottest.UserSays("HELLO"),
+		bottest.BotReplies("hi!"),
+	})
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("Run returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
@@ -0,0 +1,90 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrBotClosed = errors.New("bot is shut down")
+
+var CloseTimeout = 30 * time.Second
+
+func closeContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), CloseTimeout)
+}
+
+type lifecycle struct {
+	mu       sync.Mutex
+	closing  bool
+	inFlight sync.WaitGroup
+	done     chan struct{}
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{done: make(chan struct{})}
+}
+
+func (l *lifecycle) enter() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closing {
+		return false
+	}
+
+	l.inFlight.Add(1)
+	return true
+}
+
+func (l *lifecycle) leave() {
+	l.inFlight.Done()
+}
+
+func (l *lifecycle) closed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closing
+}
+
+func (l *lifecycle) deliver(updates chan<- *Activity, activity *Activity) bool {
+	select {
+	case updates <- activity:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *lifecycle) shutdown(ctx context.Context, updates chan *Activity) error {
+	l.mu.Lock()
+
+	if l.closing {
+		l.mu.Unlock()
+		return ErrBotClosed
+	}
+
+	l.closing = true
+	l.mu.Unlock()
+
+	drained := make(chan struct{})
+
+	go func() {
+		l.inFlight.Wait()
+		close(drained)
+	}()
+
+	var err error
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		close(l.done)
+		<-drained
+	}
+
+	close(updates)
+	return err
+}
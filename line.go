@@ -0,0 +1,546 @@
+package bots
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+const (
+	lineAPI                = "https://api.line.me"
+	lineDataAPI            = "https://api-data.line.me"
+	lineReplyTokenLifetime = 50 * time.Second
+	lineMaxMessages        = 5
+)
+
+var lineChannels = []string{ChannelLine}
+
+type LineBotConfig struct {
+	ChannelSecret      string
+	ChannelAccessToken string
+	APIEndpoint        string
+	DataEndpoint       string
+}
+
+type LineBot struct {
+	config      *LineBotConfig
+	updates     chan *Activity
+	lifecycle   *lifecycle
+	mu          sync.Mutex
+	replyTokens map[string]*lineReplyToken
+}
+
+type lineReplyToken struct {
+	token   string
+	expires time.Time
+}
+
+func NewLineBot(config *LineBotConfig) *LineBot {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = lineAPI
+	}
+
+	if config.DataEndpoint == "" {
+		config.DataEndpoint = lineDataAPI
+	}
+
+	return &LineBot{
+		config:      config,
+		updates:     make(chan *Activity),
+		lifecycle:   newLifecycle(),
+		replyTokens: make(map[string]*lineReplyToken),
+	}
+}
+
+func (b *LineBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		errorResponse(w, "unable to read body")
+		return
+	}
+
+	if !b.validSignature(body, r.Header.Get("X-Line-Signature")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	callback := &lineCallback{}
+
+	if err = json.Unmarshal(body, callback); err != nil {
+		errorResponse(w, "invalid payload")
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+
+	for _, event := range callback.Events {
+		activity := b.eventToActivity(callback.Destination, event)
+
+		if activity == nil {
+			continue
+		}
+
+		if event.ReplyToken != "" {
+			b.storeReplyToken(activity.Id, event.ReplyToken)
+		}
+
+		if !b.lifecycle.deliver(b.updates, activity) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *LineBot) validSignature(body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(b.config.ChannelSecret))
+	mac.Write(body)
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return signature != "" && hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (b *LineBot) storeReplyToken(id, token string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+
+	for k, v := range b.replyTokens {
+		if now.After(v.expires) {
+			delete(b.replyTokens, k)
+		}
+	}
+
+	b.replyTokens[id] = &lineReplyToken{token: token, expires: now.Add(lineReplyTokenLifetime)}
+}
+
+func (b *LineBot) takeReplyToken(id string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.replyTokens[id]
+
+	if !ok {
+		return ""
+	}
+
+	delete(b.replyTokens, id)
+
+	if time.Now().After(t.expires) {
+		return ""
+	}
+
+	return t.token
+}
+
+func (b *LineBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.updates, nil
+}
+
+func (b *LineBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	return forwardUpdates(ctx, b.updates), nil
+}
+
+func (b *LineBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *LineBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	to := targetConversationId(activity)
+
+	if activity.Type == TypeTyping {
+		return nil, b.call(ctx, "/v2/bot/chat/loading/start", map[string]string{"chatId": to}, nil)
+	}
+
+	messages := lineMessages(activity)
+
+	if len(messages) == 0 {
+		return nil, errors.New("nothing to send")
+	}
+
+	var response struct {
+		SentMessages []*lineSentMessage `json:"sentMessages"`
+	}
+
+	var err error
+
+	if token := b.takeReplyToken(activity.ReplyToId); token != "" {
+		err = b.call(ctx, "/v2/bot/message/reply", map[string]interface{}{"replyToken": token, "messages": messages}, &response)
+
+		if err == nil {
+			return lineIdentification(response.SentMessages), nil
+		}
+
+		// LINE answers 400 for an invalid or expired reply token; anything
+		// else may have been delivered, so pushing could duplicate it.
+		if e, ok := err.(*lineError); !ok || e.statusCode != http.StatusBadRequest {
+			return nil, err
+		}
+	}
+
+	err = b.call(ctx, "/v2/bot/message/push", map[string]interface{}{"to": to, "messages": messages}, &response)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lineIdentification(response.SentMessages), nil
+}
+
+func (b *LineBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *LineBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	return nil, errors.New("update isn't implemented for line")
+}
+
+func (b *LineBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *LineBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	return errors.New("delete isn't implemented for line")
+}
+
+func (b *LineBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *LineBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, attachment.ContentUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(attachment.ContentUrl, b.config.DataEndpoint) {
+		req.Header.Set("Authorization", "Bearer "+b.config.ChannelAccessToken)
+	}
+
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func (b *LineBot) GetChannels() []string {
+	return lineChannels
+}
+
+func (b *LineBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *LineBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *LineBot) call(ctx context.Context, path string, payload interface{}, result interface{}) error {
+	request := gorequest.New().Post(b.config.APIEndpoint+path).
+		Set("Authorization", "Bearer "+b.config.ChannelAccessToken).
+		Send(payload)
+	resp, body, err := endRequest(ctx, request)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return &lineError{path: path, body: body, statusCode: resp.StatusCode}
+	}
+
+	if result == nil || len(body) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+type lineError struct {
+	path       string
+	body       []byte
+	statusCode int
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %s failed: %s %d", e.path, e.body, e.statusCode)
+}
+
+type lineSentMessage struct {
+	Id string `json:"id"`
+}
+
+type lineCallback struct {
+	Destination string       `json:"destination"`
+	Events      []*lineEvent `json:"events"`
+}
+
+type lineSource struct {
+	Type    string `json:"type"`
+	UserId  string `json:"userId"`
+	GroupId string `json:"groupId"`
+	RoomId  string `json:"roomId"`
+}
+
+type lineEvent struct {
+	Type           string      `json:"type"`
+	WebhookEventId string      `json:"webhookEventId"`
+	ReplyToken     string      `json:"replyToken"`
+	Timestamp      int64       `json:"timestamp"`
+	Source         *lineSource `json:"source"`
+	Message        *struct {
+		Id        string  `json:"id"`
+		Type      string  `json:"type"`
+		Text      string  `json:"text"`
+		FileName  string  `json:"fileName"`
+		Title     string  `json:"title"`
+		Address   string  `json:"address"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"message"`
+	Postback *struct {
+		Data string `json:"data"`
+	} `json:"postback"`
+	Joined *struct {
+		Members []*lineSource `json:"members"`
+	} `json:"joined"`
+	Left *struct {
+		Members []*lineSource `json:"members"`
+	} `json:"left"`
+}
+
+func (b *LineBot) eventToActivity(destination string, e *lineEvent) *Activity {
+	result := &Activity{}
+	result.Id = e.WebhookEventId
+	result.ChannelId = ChannelLine
+	result.Recipient = &ChannelAccount{Identification: Identification{Id: destination}}
+
+	if e.Source != nil {
+		result.From = &ChannelAccount{Identification: Identification{Id: e.Source.UserId}}
+		conversation := &ConversationAccount{ChannelAccount: ChannelAccount{Identification: Identification{Id: e.Source.UserId}}}
+
+		switch e.Source.Type {
+		case "group":
+			conversation.Id = e.Source.GroupId
+			conversation.IsGroup = true
+		case "room":
+			conversation.Id = e.Source.RoomId
+			conversation.IsGroup = true
+		}
+
+		result.Conversation = conversation
+	}
+
+	switch e.Type {
+	case "message":
+		if e.Message == nil {
+			return nil
+		}
+
+		result.Type = TypeMessage
+		result.Id = e.Message.Id
+		result.Text = e.Message.Text
+
+		switch e.Message.Type {
+		case "image", "video", "audio", "file":
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: mediaType(e.Message.Type, e.Message.FileName),
+				ContentUrl:  b.config.DataEndpoint + "/v2/bot/message/" + e.Message.Id + "/content",
+				Name:        e.Message.FileName,
+			})
+		case "location":
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: TypeGeoCoordinates,
+				Name:        e.Message.Title,
+				Content: &GeoCoordinates{
+					Latitude:  e.Message.Latitude,
+					Longitude: e.Message.Longitude,
+					Name:      e.Message.Title,
+					Address:   e.Message.Address,
+				},
+			})
+		}
+	case "postback":
+		if e.Postback == nil {
+			return nil
+		}
+
+		result.Type = TypeMessage
+		result.Text = e.Postback.Data
+	case "follow":
+		result.Type = TypeContactRelationUpdate
+		result.Action = "add"
+	case "unfollow":
+		result.Type = TypeContactRelationUpdate
+		result.Action = "remove"
+	case "join":
+		result.Type = TypeConversationUpdate
+		result.MembersAdded = []*ChannelAccount{result.Recipient}
+	case "leave":
+		result.Type = TypeConversationUpdate
+		result.MembersRemoved = []*ChannelAccount{result.Recipient}
+	case "memberJoined", "memberLeft":
+		result.Type = TypeConversationUpdate
+
+		if e.Joined != nil {
+			for _, m := range e.Joined.Members {
+				result.MembersAdded = append(result.MembersAdded, &ChannelAccount{Identification: Identification{Id: m.UserId}})
+			}
+		}
+
+		if e.Left != nil {
+			for _, m := range e.Left.Members {
+				result.MembersRemoved = append(result.MembersRemoved, &ChannelAccount{Identification: Identification{Id: m.UserId}})
+			}
+		}
+	default:
+		return nil
+	}
+
+	return result
+}
+
+func lineIdentification(sent []*lineSentMessage) *Identification {
+	if len(sent) == 0 {
+		return &Identification{}
+	}
+
+	return &Identification{Id: sent[len(sent)-1].Id}
+}
+
+func lineMessages(activity *Activity) []map[string]interface{} {
+	var messages []map[string]interface{}
+
+	if activity.Text != "" {
+		messages = append(messages, map[string]interface{}{"type": "text", "text": activity.Text})
+	}
+
+	var bubbles []map[string]interface{}
+	altText := activity.Text
+
+	for _, a := range activity.Attachments {
+		if a.ContentType == TypeHeroCard {
+			if card, ok := a.Content.(*HeroCard); ok {
+				bubbles = append(bubbles, lineBubble(card))
+
+				if altText == "" {
+					altText = joinText(card.Title, card.Text)
+				}
+			}
+		} else if strings.HasPrefix(a.ContentType, "image") && a.ContentUrl != "" {
+			preview := a.ThumbnailUrl
+
+			if preview == "" {
+				preview = a.ContentUrl
+			}
+
+			messages = append(messages, map[string]interface{}{
+				"type":               "image",
+				"originalContentUrl": a.ContentUrl,
+				"previewImageUrl":    preview,
+			})
+		}
+	}
+
+	if len(bubbles) > 0 {
+		if altText == "" {
+			altText = "card"
+		}
+
+		var contents interface{} = bubbles[0]
+
+		if len(bubbles) > 1 {
+			contents = map[string]interface{}{"type": "carousel", "contents": bubbles}
+		}
+
+		messages = append(messages, map[string]interface{}{"type": "flex", "altText": altText, "contents": contents})
+	}
+
+	if len(messages) > lineMaxMessages {
+		messages = messages[:lineMaxMessages]
+	}
+
+	if activity.SuggestedActions != nil && len(activity.SuggestedActions.Actions) > 0 && len(messages) > 0 {
+		var items []map[string]interface{}
+
+		for _, action := range activity.SuggestedActions.Actions {
+			items = append(items, map[string]interface{}{"type": "action", "action": lineAction(action)})
+		}
+
+		messages[len(messages)-1]["quickReply"] = map[string]interface{}{"items": items}
+	}
+
+	return messages
+}
+
+func lineBubble(card *HeroCard) map[string]interface{} {
+	bubble := map[string]interface{}{"type": "bubble"}
+
+	if len(card.Images) > 0 {
+		bubble["hero"] = map[string]interface{}{
+			"type":       "image",
+			"url":        card.Images[0].Url,
+			"size":       "full",
+			"aspectMode": "cover",
+		}
+	}
+
+	var body []map[string]interface{}
+
+	if card.Title != "" {
+		body = append(body, map[string]interface{}{"type": "text", "text": card.Title, "weight": "bold", "size": "lg", "wrap": true})
+	}
+
+	if card.Text != "" {
+		body = append(body, map[string]interface{}{"type": "text", "text": card.Text, "wrap": true})
+	}
+
+	if len(body) > 0 {
+		bubble["body"] = map[string]interface{}{"type": "box", "layout": "vertical", "contents": body}
+	}
+
+	var buttons []map[string]interface{}
+
+	for _, action := range card.Buttons {
+		buttons = append(buttons, map[string]interface{}{"type": "button", "action": lineAction(action)})
+	}
+
+	if len(buttons) > 0 {
+		bubble["footer"] = map[string]interface{}{"type": "box", "layout": "vertical", "contents": buttons}
+	}
+
+	return bubble
+}
+
+func lineAction(action *CardAction) map[string]string {
+	switch action.Type {
+	case TypeOpenUrl:
+		return map[string]string{"type": "uri", "label": action.Title, "uri": action.Value}
+	case TypePostBack:
+		return map[string]string{"type": "postback", "label": action.Title, "data": action.Value}
+	default:
+		return map[string]string{"type": "message", "label": action.Title, "text": action.Value}
+	}
+}
@@ -0,0 +1,185 @@
+package bots
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func lineSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestLineSignature(t *testing.T) {
+	body := `{"destination":"B1","events":[{"type":"message","replyToken":"r1","source":{"type":"user","userId":"U1"},"message":{"id":"m1","type":"text","text":"hi"}}]}`
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		status    int
+	}{
+		{"valid", body, lineSignature("secret", body), http.StatusOK},
+		{"tampered body", strings.Replace(body, "hi", "bye", 1), lineSignature("secret", body), http.StatusUnauthorized},
+		{"wrong secret", body, lineSignature("other", body), http.StatusUnauthorized},
+		{"missing signature", body, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewLineBot(&LineBotConfig{ChannelSecret: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/line", strings.NewReader(tt.body))
+			r.Header.Set("X-Line-Signature", tt.signature)
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if tt.status == http.StatusOK && (activity == nil || activity.Text != "hi") {
+				t.Fatalf("unexpected activity %+v", activity)
+			} else if tt.status != http.StatusOK && activity != nil {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+		})
+	}
+}
+
+func TestLineLocation(t *testing.T) {
+	body := `{"destination":"B1","events":[{"type":"message","source":{"type":"user","userId":"U1"},"message":{"id":"m1","type":"location","title":"Office","address":"Tokyo","latitude":35.5,"longitude":139.5}}]}`
+	bot := NewLineBot(&LineBotConfig{ChannelSecret: "secret"})
+	r := httptest.NewRequest(http.MethodPost, "/line", strings.NewReader(body))
+	r.Header.Set("X-Line-Signature", lineSignature("secret", body))
+	_, activity := serveWebhook(bot, bot.updates, r)
+
+	if activity == nil || len(activity.Attachments) != 1 || activity.Attachments[0].ContentType != TypeGeoCoordinates {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	geo, ok := activity.Attachments[0].Content.(*GeoCoordinates)
+
+	if !ok || geo.Latitude != 35.5 || geo.Longitude != 139.5 || geo.Name != "Office" || geo.Address != "Tokyo" {
+		t.Fatalf("unexpected coordinates %+v", activity.Attachments[0].Content)
+	}
+}
+
+func TestLineReplyFallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		replyToken  bool
+		replyStatus int
+		calls       []string
+		ok          bool
+	}{
+		{"reply", true, http.StatusOK, []string{"reply"}, true},
+		{"invalid reply token", true, http.StatusBadRequest, []string{"reply", "push"}, true},
+		{"server error", true, http.StatusInternalServerError, []string{"reply"}, false},
+		{"throttled", true, http.StatusTooManyRequests, []string{"reply"}, false},
+		{"no reply token", false, 0, []string{"push"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				call := strings.TrimPrefix(r.URL.Path, "/v2/bot/message/")
+				calls = append(calls, call)
+
+				if call == "reply" && tt.replyStatus != http.StatusOK {
+					w.WriteHeader(tt.replyStatus)
+					w.Write([]byte(`{"message":"Invalid reply token"}`))
+					return
+				}
+
+				w.Write([]byte(`{"sentMessages":[{"id":"s1"}]}`))
+			}))
+			defer server.Close()
+
+			bot := NewLineBot(&LineBotConfig{APIEndpoint: server.URL})
+
+			if tt.replyToken {
+				bot.storeReplyToken("m1", "r1")
+			}
+
+			activity := &Activity{
+				Type:         TypeMessage,
+				Text:         "hello",
+				ReplyToId:    "m1",
+				Conversation: &ConversationAccount{ChannelAccount: ChannelAccount{Identification: Identification{Id: "U1"}}},
+			}
+
+			id, err := bot.Send(activity)
+
+			if (err == nil) != tt.ok {
+				t.Fatalf("Send = %v, %v, want ok = %v", id, err, tt.ok)
+			}
+
+			if strings.Join(calls, ",") != strings.Join(tt.calls, ",") {
+				t.Fatalf("calls = %v, want %v", calls, tt.calls)
+			}
+
+			if tt.ok && id.Id != "s1" {
+				t.Fatalf("unexpected id %+v", id)
+			}
+		})
+	}
+}
+
+func TestLineMediaTypes(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{`{"id":"m1","type":"image"}`, "image/jpeg"},
+		{`{"id":"m1","type":"video"}`, "video/mp4"},
+		{`{"id":"m1","type":"audio"}`, "audio/mp4"},
+		{`{"id":"m1","type":"file","fileName":"report.pdf"}`, "application/pdf"},
+		{`{"id":"m1","type":"file","fileName":"notes"}`, "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			body := `{"destination":"B1","events":[{"type":"message","source":{"type":"user","userId":"U1"},"message":` + tt.message + `}]}`
+			bot := NewLineBot(&LineBotConfig{ChannelSecret: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/line", strings.NewReader(body))
+			r.Header.Set("X-Line-Signature", lineSignature("secret", body))
+			_, activity := serveWebhook(bot, bot.updates, r)
+
+			if activity == nil || len(activity.Attachments) != 1 {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+
+			if a := activity.Attachments[0]; a.ContentType != tt.want || a.ContentUrl != lineDataAPI+"/v2/bot/message/m1/content" {
+				t.Fatalf("attachment = %+v, want content type %s", a, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaType(t *testing.T) {
+	tests := []struct {
+		kind string
+		name string
+		want string
+	}{
+		{"image", "", "image/jpeg"},
+		{"image", "photo.png", "image/png"},
+		{"image", "photo.pdf", "image/jpeg"},
+		{"image", "https://cdn.example.com/a/photo.png", "image/png"},
+		{"file", "report.pdf", "application/pdf"},
+		{"file", "", "application/octet-stream"},
+		{"fallback", "page.html", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		if got := mediaType(tt.kind, tt.name); got != tt.want {
+			t.Errorf("mediaType(%q, %q) = %q, want %q", tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
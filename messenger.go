@@ -0,0 +1,409 @@
+package bots
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+const graphAPI = "https://graph.facebook.com/v18.0"
+
+var messengerChannels = []string{ChannelFacebook}
+
+type MessengerBotConfig struct {
+	PageAccessToken string
+	AppSecret       string
+	VerifyToken     string
+	APIEndpoint     string
+}
+
+type MessengerBot struct {
+	config    *MessengerBotConfig
+	updates   chan *Activity
+	lifecycle *lifecycle
+}
+
+func NewMessengerBot(config *MessengerBotConfig) *MessengerBot {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = graphAPI
+	}
+
+	return &MessengerBot{
+		config:    config,
+		updates:   make(chan *Activity),
+		lifecycle: newLifecycle(),
+	}
+}
+
+func (b *MessengerBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		verifyHubChallenge(w, r, b.config.VerifyToken)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		errorResponse(w, "unable to read body")
+		return
+	}
+
+	if !validHubSignature(b.config.AppSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	callback := &messengerCallback{}
+
+	if err = json.Unmarshal(body, callback); err != nil {
+		errorResponse(w, "invalid payload")
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+
+	for _, entry := range callback.Entry {
+		for _, event := range entry.Messaging {
+			activity := messengerToActivity(event)
+
+			if activity == nil {
+				continue
+			}
+
+			if !b.lifecycle.deliver(b.updates, activity) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *MessengerBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.updates, nil
+}
+
+func (b *MessengerBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	return forwardUpdates(ctx, b.updates), nil
+}
+
+func (b *MessengerBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *MessengerBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	recipient := map[string]string{"id": targetUserId(activity)}
+
+	if activity.Type == TypeTyping {
+		return nil, b.call(ctx, map[string]interface{}{"recipient": recipient, "sender_action": "typing_on"}, nil)
+	}
+
+	messages := messengerMessages(activity)
+	result := &Identification{}
+
+	for _, message := range messages {
+		var response struct {
+			MessageId string `json:"message_id"`
+		}
+
+		err := b.call(ctx, map[string]interface{}{
+			"recipient":      recipient,
+			"messaging_type": "RESPONSE",
+			"message":        message,
+		}, &response)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result.Id = response.MessageId
+	}
+
+	return result, nil
+}
+
+func (b *MessengerBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *MessengerBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	return nil, errors.New("update isn't implemented for messenger")
+}
+
+func (b *MessengerBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *MessengerBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	return errors.New("delete isn't implemented for messenger")
+}
+
+func (b *MessengerBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *MessengerBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, attachment.ContentUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func (b *MessengerBot) GetChannels() []string {
+	return messengerChannels
+}
+
+func (b *MessengerBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *MessengerBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *MessengerBot) call(ctx context.Context, payload interface{}, result interface{}) error {
+	request := gorequest.New().Post(b.config.APIEndpoint + "/me/messages?access_token=" + b.config.PageAccessToken).Send(payload)
+	resp, body, err := endRequest(ctx, request)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return errors.New(fmt.Sprintf("messenger send failed: %s %d", body, resp.StatusCode))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+func verifyHubChallenge(w http.ResponseWriter, r *http.Request, verifyToken string) {
+	query := r.URL.Query()
+
+	if query.Get("hub.mode") != "subscribe" || verifyToken == "" || query.Get("hub.verify_token") != verifyToken {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.Write([]byte(query.Get("hub.challenge")))
+}
+
+func validHubSignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+type messengerCallback struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		Id        string            `json:"id"`
+		Messaging []*messengerEvent `json:"messaging"`
+	} `json:"entry"`
+}
+
+type messengerEvent struct {
+	Sender struct {
+		Id string `json:"id"`
+	} `json:"sender"`
+	Recipient struct {
+		Id string `json:"id"`
+	} `json:"recipient"`
+	Timestamp int64 `json:"timestamp"`
+	Message   *struct {
+		Mid        string `json:"mid"`
+		Text       string `json:"text"`
+		IsEcho     bool   `json:"is_echo"`
+		QuickReply *struct {
+			Payload string `json:"payload"`
+		} `json:"quick_reply"`
+		Attachments []struct {
+			Type    string `json:"type"`
+			Payload struct {
+				Url string `json:"url"`
+			} `json:"payload"`
+		} `json:"attachments"`
+	} `json:"message"`
+	Postback *struct {
+		Mid     string `json:"mid"`
+		Title   string `json:"title"`
+		Payload string `json:"payload"`
+	} `json:"postback"`
+}
+
+func messengerToActivity(e *messengerEvent) *Activity {
+	result := &Activity{}
+	result.ChannelId = ChannelFacebook
+	result.Type = TypeMessage
+	result.From = &ChannelAccount{Identification: Identification{Id: e.Sender.Id}}
+	result.Recipient = &ChannelAccount{Identification: Identification{Id: e.Recipient.Id}}
+	result.Conversation = &ConversationAccount{ChannelAccount: *result.From}
+
+	switch {
+	case e.Message != nil && !e.Message.IsEcho:
+		result.Id = e.Message.Mid
+		result.Text = e.Message.Text
+
+		if e.Message.QuickReply != nil {
+			result.Text = e.Message.QuickReply.Payload
+		}
+
+		for _, a := range e.Message.Attachments {
+			if a.Payload.Url == "" {
+				continue
+			}
+
+			name := a.Payload.Url
+
+			if u, err := url.Parse(a.Payload.Url); err == nil {
+				name = u.Path
+			}
+
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: mediaType(a.Type, name),
+				ContentUrl:  a.Payload.Url,
+			})
+		}
+	case e.Postback != nil:
+		result.Id = e.Postback.Mid
+		result.Text = e.Postback.Payload
+	default:
+		return nil
+	}
+
+	return result
+}
+
+func messengerMessages(activity *Activity) []map[string]interface{} {
+	var messages []map[string]interface{}
+
+	if activity.Text != "" {
+		messages = append(messages, map[string]interface{}{"text": activity.Text})
+	}
+
+	var elements []map[string]interface{}
+
+	for _, a := range activity.Attachments {
+		if a.ContentType == TypeHeroCard {
+			if card, ok := a.Content.(*HeroCard); ok {
+				elements = append(elements, messengerElement(card))
+			}
+		} else if a.ContentUrl != "" {
+			messages = append(messages, map[string]interface{}{
+				"attachment": map[string]interface{}{
+					"type":    messengerAttachmentType(a.ContentType),
+					"payload": map[string]interface{}{"url": a.ContentUrl, "is_reusable": true},
+				},
+			})
+		}
+	}
+
+	if len(elements) > 0 {
+		messages = append(messages, map[string]interface{}{
+			"attachment": map[string]interface{}{
+				"type": "template",
+				"payload": map[string]interface{}{
+					"template_type": "generic",
+					"elements":      elements,
+				},
+			},
+		})
+	}
+
+	if activity.SuggestedActions != nil && len(activity.SuggestedActions.Actions) > 0 {
+		if len(messages) == 0 {
+			messages = append(messages, map[string]interface{}{"text": " "})
+		}
+
+		var quickReplies []map[string]string
+
+		for _, action := range activity.SuggestedActions.Actions {
+			quickReplies = append(quickReplies, map[string]string{
+				"content_type": "text",
+				"title":        action.Title,
+				"payload":      action.Value,
+			})
+		}
+
+		messages[len(messages)-1]["quick_replies"] = quickReplies
+	}
+
+	return messages
+}
+
+func messengerElement(card *HeroCard) map[string]interface{} {
+	element := map[string]interface{}{"title": card.Title}
+
+	if card.Text != "" {
+		element["subtitle"] = card.Text
+	}
+
+	if len(card.Images) > 0 {
+		element["image_url"] = card.Images[0].Url
+	}
+
+	var buttons []map[string]string
+
+	for _, action := range card.Buttons {
+		if len(buttons) == 3 {
+			break
+		}
+
+		if action.Type == TypeOpenUrl {
+			buttons = append(buttons, map[string]string{"type": "web_url", "url": action.Value, "title": action.Title})
+		} else {
+			buttons = append(buttons, map[string]string{"type": "postback", "payload": action.Value, "title": action.Title})
+		}
+	}
+
+	if len(buttons) > 0 {
+		element["buttons"] = buttons
+	}
+
+	return element
+}
+
+func messengerAttachmentType(contentType string) string {
+	for _, t := range []string{"image", "video", "audio"} {
+		if strings.HasPrefix(contentType, t) {
+			return t
+		}
+	}
+
+	return "file"
+}
@@ -0,0 +1,115 @@
+package bots
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func hubSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestMessengerSignature(t *testing.T) {
+	body := `{"object":"page","entry":[{"id":"P1","messaging":[{"sender":{"id":"U1"},"recipient":{"id":"P1"},"timestamp":1,"message":{"mid":"m1","text":"hi"}}]}]}`
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		status    int
+	}{
+		{"valid", body, hubSignature("secret", body), http.StatusOK},
+		{"tampered body", strings.Replace(body, "hi", "bye", 1), hubSignature("secret", body), http.StatusUnauthorized},
+		{"wrong secret", body, hubSignature("other", body), http.StatusUnauthorized},
+		{"missing prefix", body, strings.TrimPrefix(hubSignature("secret", body), "sha256="), http.StatusUnauthorized},
+		{"missing signature", body, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewMessengerBot(&MessengerBotConfig{AppSecret: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/messenger", strings.NewReader(tt.body))
+			r.Header.Set("X-Hub-Signature-256", tt.signature)
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if tt.status == http.StatusOK && (activity == nil || activity.Text != "hi" || activity.From.Id != "U1") {
+				t.Fatalf("unexpected activity %+v", activity)
+			} else if tt.status != http.StatusOK && activity != nil {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+		})
+	}
+}
+
+func TestMessengerVerifyChallenge(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		body   string
+	}{
+		{"valid", "hub.mode=subscribe&hub.verify_token=token&hub.challenge=abc", http.StatusOK, "abc"},
+		{"wrong token", "hub.mode=subscribe&hub.verify_token=other&hub.challenge=abc", http.StatusForbidden, ""},
+		{"wrong mode", "hub.mode=unsubscribe&hub.verify_token=token&hub.challenge=abc", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewMessengerBot(&MessengerBotConfig{VerifyToken: "token"})
+			w := httptest.NewRecorder()
+			bot.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/messenger?"+tt.query, nil))
+
+			if w.Code != tt.status || w.Body.String() != tt.body {
+				t.Fatalf("got %d %q, want %d %q", w.Code, w.Body.String(), tt.status, tt.body)
+			}
+		})
+	}
+}
+
+func TestMessengerMediaTypes(t *testing.T) {
+	tests := []struct {
+		kind string
+		url  string
+		want string
+	}{
+		{"image", "https://cdn.example.com/a/photo.png?_nc_cat=1&oh=abc", "image/png"},
+		{"image", "https://cdn.example.com/a/photo?oh=abc", "image/jpeg"},
+		{"video", "https://cdn.example.com/a/clip?oh=abc", "video/mp4"},
+		{"audio", "https://cdn.example.com/a/voice?oh=abc", "audio/mp4"},
+		{"file", "https://cdn.example.com/a/report.pdf?oh=abc", "application/pdf"},
+		{"file", "https://cdn.example.com/a/report?oh=abc", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			body := `{"object":"page","entry":[{"id":"P1","messaging":[{"sender":{"id":"U1"},"recipient":{"id":"P1"},"timestamp":1,"message":{"mid":"m1","attachments":[{"type":"` + tt.kind + `","payload":{"url":"` + tt.url + `"}}]}}]}]}`
+			bot := NewMessengerBot(&MessengerBotConfig{AppSecret: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/messenger", strings.NewReader(body))
+			r.Header.Set("X-Hub-Signature-256", hubSignature("secret", body))
+			_, activity := serveWebhook(bot, bot.updates, r)
+
+			if activity == nil || len(activity.Attachments) != 1 {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+
+			if a := activity.Attachments[0]; a.ContentType != tt.want || a.ContentUrl != tt.url {
+				t.Fatalf("attachment = %+v, want content type %s", a, tt.want)
+			}
+
+			if got := messengerAttachmentType(activity.Attachments[0].ContentType); got != tt.kind {
+				t.Fatalf("outbound type = %s, want %s", got, tt.kind)
+			}
+		})
+	}
+}
@@ -1,80 +1,313 @@
 package bots
 
 import (
-	"crypto/rsa"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/nickalie/bots/utils"
 	"github.com/parnurzeal/gorequest"
 	"gopkg.in/square/go-jose.v2"
 )
 
+const (
+	openIdDefaultMaxAge        = 24 * time.Hour
+	openIdMinMaxAge            = 5 * time.Minute
+	openIdMaxMaxAge            = 5 * 24 * time.Hour
+	openIdForcedRefreshBackoff = 5 * time.Minute
+	openIdRefreshTimeout       = 30 * time.Second
+	openIdRetryInterval        = time.Minute
+)
+
+type OpenIdKey struct {
+	KeyId        string
+	Algorithm    string
+	Key          interface{}
+	Endorsements []string
+}
+
+func (k *OpenIdKey) Endorsed(channelId string) bool {
+	for _, v := range k.Endorsements {
+		if v == channelId {
+			return true
+		}
+	}
+
+	return false
+}
+
 type OpenIdMetadata struct {
-	url         string
-	lastUpdated int64
-	keys        []jose.JSONWebKey
+	url        string
+	mu         sync.RWMutex
+	keys       map[string]*OpenIdKey
+	issuer     string
+	expires    time.Time
+	generation int
+	refreshMu  sync.Mutex
+	lastFetch  time.Time
+	lastErr    error
+	retryAt    time.Time
+	timer      *time.Timer
+	closed     bool
 }
 
 func NewOpenIdMetadata(url string) *OpenIdMetadata {
 	return &OpenIdMetadata{url: url}
 }
 
-func (o *OpenIdMetadata) GetKey(kid string) (*rsa.PublicKey, error) {
-	if o.lastUpdated < (time.Now().Unix() - 60*60*24*5) {
-		err := o.refreshCache()
+func (o *OpenIdMetadata) GetKey(kid string) (interface{}, error) {
+	key, err := o.GetSigningKey(kid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key.Key, nil
+}
+
+func (o *OpenIdMetadata) GetSigningKey(kid string) (*OpenIdKey, error) {
+	key, generation, fresh := o.lookup(kid)
+
+	if !fresh {
+		err := o.refresh(generation, false)
 
-		if err != nil {
-			fmt.Printf("refreshCache: %v\n", err)
+		if err != nil && generation == 0 {
 			return nil, err
 		}
+
+		key, generation, _ = o.lookup(kid)
+	}
+
+	if key == nil {
+		o.refresh(generation, true)
+		key, _, _ = o.lookup(kid)
+	}
+
+	if key == nil {
+		return nil, errors.New("key not found: " + kid)
+	}
+
+	return key, nil
+}
+
+func (o *OpenIdMetadata) Close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+}
+
+func (o *OpenIdMetadata) lookup(kid string) (*OpenIdKey, int, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.keys[kid], o.generation, o.generation > 0 && time.Now().Before(o.expires)
+}
+
+func (o *OpenIdMetadata) refresh(generation int, force bool) error {
+	o.refreshMu.Lock()
+	defer o.refreshMu.Unlock()
+
+	if o.currentGeneration() != generation {
+		return nil
+	}
+
+	if force && time.Since(o.lastFetch) < openIdForcedRefreshBackoff {
+		return nil
+	}
+
+	if !force && time.Now().Before(o.retryAt) {
+		return o.lastErr
+	}
+
+	return o.update()
+}
+
+func (o *OpenIdMetadata) update() error {
+	ctx, cancel := context.WithTimeout(context.Background(), openIdRefreshTimeout)
+	defer cancel()
+	keys, issuer, maxAge, err := o.fetch(ctx)
+	o.lastFetch = time.Now()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if err != nil {
+		o.lastErr = err
+		o.retryAt = time.Now().Add(openIdRetryInterval)
+
+		if o.generation > 0 {
+			o.expires = o.retryAt
+		}
+
+		o.schedule(openIdRetryInterval)
+		return err
+	}
+
+	o.lastErr = nil
+	o.retryAt = time.Time{}
+	o.keys = keys
+	o.issuer = issuer
+	o.expires = time.Now().Add(maxAge)
+	o.generation++
+	o.schedule(maxAge)
+	return nil
+}
+
+func (o *OpenIdMetadata) currentIssuer() string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.issuer
+}
+
+func (o *OpenIdMetadata) currentGeneration() int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.generation
+}
+
+func (o *OpenIdMetadata) schedule(d time.Duration) {
+	if o.closed {
+		return
+	}
+
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+
+	generation := o.generation
+	o.timer = time.AfterFunc(d, func() {
+		o.refreshMu.Lock()
+		defer o.refreshMu.Unlock()
+
+		if o.currentGeneration() == generation {
+			o.update()
+		}
+	})
+}
+
+func (o *OpenIdMetadata) fetch(ctx context.Context) (map[string]*OpenIdKey, string, time.Duration, error) {
+	var openIdConfig IOpenIdConfig
+	resp, body, err := endRequest(ctx, gorequest.New().Get(o.url))
+
+	if err == nil && resp.StatusCode >= 400 {
+		err = errors.New(fmt.Sprintf("Failed to load openID config: %d", resp.StatusCode))
+	}
+
+	if err == nil {
+		err = json.Unmarshal(body, &openIdConfig)
+	}
+
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	resp, body, err = endRequest(ctx, gorequest.New().Get(openIdConfig.JwksUri))
+
+	if err == nil && resp.StatusCode >= 400 {
+		err = errors.New(fmt.Sprintf("Failed to load keys: %d", resp.StatusCode))
+	}
+
+	if err != nil {
+		return nil, "", 0, err
 	}
 
-	for _, key := range o.keys {
-		if key.KeyID != kid {
+	keys, err := parseOpenIdKeys(body)
+
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return keys, openIdConfig.Issuer, cacheMaxAge(resp.Header), nil
+}
+
+func parseOpenIdKeys(body []byte) (map[string]*OpenIdKey, error) {
+	var keySet struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+
+	err := json.Unmarshal(body, &keySet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*OpenIdKey)
+
+	for _, raw := range keySet.Keys {
+		var jwk jose.JSONWebKey
+
+		if err := jwk.UnmarshalJSON(raw); err != nil {
 			continue
 		}
 
-		publicKey, ok := key.Key.(*rsa.PublicKey)
+		var extra struct {
+			Endorsements []string `json:"endorsements"`
+		}
+
+		json.Unmarshal(raw, &extra)
+		public := jwk.Public()
 
-		if !ok {
+		if public.Key == nil {
 			continue
 		}
 
-		return publicKey, nil
+		result[jwk.KeyID] = &OpenIdKey{
+			KeyId:        jwk.KeyID,
+			Algorithm:    jwk.Algorithm,
+			Key:          public.Key,
+			Endorsements: extra.Endorsements,
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("no usable keys in JWKS")
 	}
 
-	return nil, errors.New("key not found: " + kid)
+	return result, nil
 }
 
-func (o *OpenIdMetadata) refreshCache() error {
-	var openIdConfig IOpenIdConfig
+func cacheMaxAge(header http.Header) time.Duration {
+	maxAge := openIdDefaultMaxAge
+	found := false
 
-	resp, _, errs := gorequest.New().Get(o.url).EndStruct(&openIdConfig)
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
 
-	if len(errs) == 0 && resp.StatusCode >= 400 {
-		errs = append(errs, errors.New(fmt.Sprintf("Failed to load openID config: %d", resp.StatusCode)))
-	}
+		if directive == "no-cache" || directive == "no-store" {
+			return openIdMinMaxAge
+		}
 
-	if len(errs) > 0 {
-		return utils.ErrorFromArray(errs)
+		if strings.HasPrefix(directive, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil {
+				maxAge = time.Duration(seconds) * time.Second
+				found = true
+			}
+		}
 	}
 
-	var jwkResponse jose.JSONWebKeySet
-	resp, _, errs = gorequest.New().Get(openIdConfig.JwksUri).EndStruct(&jwkResponse)
+	if !found {
+		if t, err := http.ParseTime(header.Get("Expires")); err == nil {
+			maxAge = time.Until(t)
+		}
+	}
 
-	if len(errs) == 0 && resp.StatusCode >= 400 {
-		errs = append(errs, errors.New(fmt.Sprintf("Failed to load keys: %d", resp.StatusCode)))
+	if maxAge < openIdMinMaxAge {
+		return openIdMinMaxAge
 	}
 
-	if len(errs) > 0 {
-		return utils.ErrorFromArray(errs)
+	if maxAge > openIdMaxMaxAge {
+		return openIdMaxMaxAge
 	}
 
-	o.lastUpdated = time.Now().Unix()
-	o.keys = jwkResponse.Keys
-	return nil
+	return maxAge
 }
 
 type IOpenIdConfig struct {
@@ -0,0 +1,210 @@
+package bots
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+type metadataServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	kid     string
+	key     *rsa.PrivateKey
+	header  http.Header
+	fail    bool
+	fetches int
+}
+
+func newMetadataServer(t *testing.T, kid string) *metadataServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &metadataServer{kid: kid, key: key, header: http.Header{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": "https://issuer.example.com", "jwks_uri": s.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+
+		if s.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &s.key.PublicKey, KeyID: s.kid, Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *metadataServer) set(f func(s *metadataServer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s)
+}
+
+func (s *metadataServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func TestOpenIdMetadataForcedRefresh(t *testing.T) {
+	server := newMetadataServer(t, "old")
+	metadata := NewOpenIdMetadata(server.URL + "/config")
+	defer metadata.Close()
+
+	if _, err := metadata.GetSigningKey("old"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.set(func(s *metadataServer) { s.kid = "new" })
+
+	if _, err := metadata.GetSigningKey("new"); err == nil {
+		t.Fatal("unknown key found without a refresh")
+	}
+
+	if n := server.fetchCount(); n != 1 {
+		t.Fatalf("keys fetched %d times within the forced refresh backoff, want 1", n)
+	}
+
+	metadata.refreshMu.Lock()
+	metadata.lastFetch = time.Now().Add(-openIdForcedRefreshBackoff)
+	metadata.refreshMu.Unlock()
+	key, err := metadata.GetSigningKey("new")
+
+	if err != nil || key.KeyId != "new" {
+		t.Fatalf("GetSigningKey = %+v, %v", key, err)
+	}
+
+	if n := server.fetchCount(); n != 2 {
+		t.Fatalf("keys fetched %d times, want 2", n)
+	}
+
+	if issuer := metadata.currentIssuer(); issuer != "https://issuer.example.com" {
+		t.Fatalf("issuer = %q", issuer)
+	}
+}
+
+func TestOpenIdMetadataCacheHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header
+		expires time.Duration
+		want    time.Duration
+	}{
+		{"none", http.Header{}, 0, openIdDefaultMaxAge},
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=3600"}}, 0, time.Hour},
+		{"max-age below minimum", http.Header{"Cache-Control": {"max-age=10"}}, 0, openIdMinMaxAge},
+		{"max-age above maximum", http.Header{"Cache-Control": {"max-age=9999999"}}, 0, openIdMaxMaxAge},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache"}}, 0, openIdMinMaxAge},
+		{"no-store", http.Header{"Cache-Control": {"private, no-store"}}, 0, openIdMinMaxAge},
+		{"invalid max-age", http.Header{"Cache-Control": {"max-age=soon"}}, 0, openIdDefaultMaxAge},
+		{"expires", http.Header{}, 2 * time.Hour, 2 * time.Hour},
+		{"max-age wins over expires", http.Header{"Cache-Control": {"max-age=3600"}}, 2 * time.Hour, time.Hour},
+		{"expired", http.Header{}, -time.Hour, openIdMinMaxAge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMetadataServer(t, "kid")
+
+			// Expires is set here so that key generation and earlier cases do not shorten it.
+			if tt.expires != 0 {
+				tt.header.Set("Expires", time.Now().Add(tt.expires).UTC().Format(http.TimeFormat))
+			}
+
+			server.set(func(s *metadataServer) { s.header = tt.header })
+			metadata := NewOpenIdMetadata(server.URL + "/config")
+			defer metadata.Close()
+			start := time.Now()
+
+			if _, err := metadata.GetSigningKey("kid"); err != nil {
+				t.Fatal(err)
+			}
+
+			metadata.mu.RLock()
+			maxAge := metadata.expires.Sub(start)
+			metadata.mu.RUnlock()
+
+			if maxAge < tt.want-2*time.Second || maxAge > tt.want+2*time.Second {
+				t.Fatalf("keys cached for %v, want %v", maxAge, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenIdMetadataServesStaleKeys(t *testing.T) {
+	server := newMetadataServer(t, "kid")
+	metadata := NewOpenIdMetadata(server.URL + "/config")
+	defer metadata.Close()
+
+	if _, err := metadata.GetSigningKey("kid"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.set(func(s *metadataServer) { s.fail = true })
+	metadata.mu.Lock()
+	metadata.expires = time.Now().Add(-time.Second)
+	metadata.mu.Unlock()
+
+	for i := 0; i < 3; i++ {
+		key, err := metadata.GetSigningKey("kid")
+
+		if err != nil || key.KeyId != "kid" {
+			t.Fatalf("GetSigningKey after a failed fetch = %+v, %v", key, err)
+		}
+	}
+
+	if n := server.fetchCount(); n != 2 {
+		t.Fatalf("keys fetched %d times, want one retry before the retry interval", n)
+	}
+
+	metadata.mu.RLock()
+	retryIn := time.Until(metadata.expires)
+	metadata.mu.RUnlock()
+
+	if retryIn <= 0 || retryIn > openIdRetryInterval {
+		t.Fatalf("stale keys expire in %v, want within %v", retryIn, openIdRetryInterval)
+	}
+}
+
+func TestOpenIdMetadataInitialFailure(t *testing.T) {
+	server := newMetadataServer(t, "kid")
+	server.set(func(s *metadataServer) { s.fail = true })
+	metadata := NewOpenIdMetadata(server.URL + "/config")
+	defer metadata.Close()
+
+	if _, err := metadata.GetSigningKey("kid"); err == nil {
+		t.Fatal("expected an error without any keys")
+	}
+
+	if _, err := metadata.GetSigningKey("kid"); err == nil {
+		t.Fatal("expected the cached error")
+	}
+
+	if n := server.fetchCount(); n != 1 {
+		t.Fatalf("keys fetched %d times, want 1 within the retry interval", n)
+	}
+}
@@ -0,0 +1,165 @@
+package bots
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type OutboundFunc func(ctx context.Context, activity *Activity) (*Identification, error)
+
+type Middleware interface {
+	Inbound(ctx context.Context, activity *Activity, next func(activity *Activity))
+	Outbound(ctx context.Context, activity *Activity, next OutboundFunc) (*Identification, error)
+}
+
+type MiddlewareFuncs struct {
+	InboundFunc  func(ctx context.Context, activity *Activity, next func(activity *Activity))
+	OutboundFunc func(ctx context.Context, activity *Activity, next OutboundFunc) (*Identification, error)
+}
+
+func (m *MiddlewareFuncs) Inbound(ctx context.Context, activity *Activity, next func(activity *Activity)) {
+	if m.InboundFunc == nil {
+		next(activity)
+		return
+	}
+
+	m.InboundFunc(ctx, activity, next)
+}
+
+func (m *MiddlewareFuncs) Outbound(ctx context.Context, activity *Activity, next OutboundFunc) (*Identification, error) {
+	if m.OutboundFunc == nil {
+		return next(ctx, activity)
+	}
+
+	return m.OutboundFunc(ctx, activity, next)
+}
+
+type MiddlewareBot struct {
+	bot        Bot
+	mu         sync.RWMutex
+	middleware []Middleware
+}
+
+func NewMiddlewareBot(bot Bot, middleware ...Middleware) *MiddlewareBot {
+	return &MiddlewareBot{bot: bot, middleware: middleware}
+}
+
+func (b *MiddlewareBot) Use(middleware ...Middleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middleware = append(b.middleware, middleware...)
+}
+
+func (b *MiddlewareBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.bot.ServeHTTP(w, r)
+}
+
+func (b *MiddlewareBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *MiddlewareBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	return b.runOutbound(ctx, b.getMiddleware(), activity, contextBot(b.bot).SendContext)
+}
+
+func (b *MiddlewareBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *MiddlewareBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	return b.runOutbound(ctx, b.getMiddleware(), activity, contextBot(b.bot).UpdateContext)
+}
+
+func (b *MiddlewareBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *MiddlewareBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	_, err := b.runOutbound(ctx, b.getMiddleware(), activity, func(ctx context.Context, activity *Activity) (*Identification, error) {
+		return nil, contextBot(b.bot).DeleteContext(ctx, activity)
+	})
+	return err
+}
+
+func (b *MiddlewareBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.GetUpdatesChannelContext(context.Background())
+}
+
+func (b *MiddlewareBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	updates, err := contextBot(b.bot).GetUpdatesChannelContext(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(chan *Activity)
+
+	go func() {
+		defer close(result)
+
+		for activity := range updates {
+			b.runInbound(ctx, b.getMiddleware(), activity, func(activity *Activity) {
+				select {
+				case result <- activity:
+				case <-ctx.Done():
+				}
+			})
+		}
+	}()
+
+	return result, nil
+}
+
+func (b *MiddlewareBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.bot.GetFile(attachment, activity)
+}
+
+func (b *MiddlewareBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return contextBot(b.bot).GetFileContext(ctx, attachment, activity)
+}
+
+func (b *MiddlewareBot) GetChannels() []string {
+	return b.bot.GetChannels()
+}
+
+func (b *MiddlewareBot) Shutdown(ctx context.Context) error {
+	if s, ok := b.bot.(Shutdowner); ok {
+		return s.Shutdown(ctx)
+	}
+
+	return nil
+}
+
+func (b *MiddlewareBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *MiddlewareBot) getMiddleware() []Middleware {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.middleware
+}
+
+func (b *MiddlewareBot) runInbound(ctx context.Context, middleware []Middleware, activity *Activity, last func(activity *Activity)) {
+	if len(middleware) == 0 {
+		last(activity)
+		return
+	}
+
+	middleware[0].Inbound(ctx, activity, func(activity *Activity) {
+		b.runInbound(ctx, middleware[1:], activity, last)
+	})
+}
+
+func (b *MiddlewareBot) runOutbound(ctx context.Context, middleware []Middleware, activity *Activity, last OutboundFunc) (*Identification, error) {
+	if len(middleware) == 0 {
+		return last(ctx, activity)
+	}
+
+	return middleware[0].Outbound(ctx, activity, func(ctx context.Context, activity *Activity) (*Identification, error) {
+		return b.runOutbound(ctx, middleware[1:], activity, last)
+	})
+}
@@ -0,0 +1,187 @@
+package bots_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/bottest"
+)
+
+type recorder struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (r *recorder) add(entry string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.log = append(r.log, entry)
+}
+
+func (r *recorder) entries() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := r.log
+	r.log = nil
+	return result
+}
+
+func (r *recorder) middleware(name string) bots.Middleware {
+	return &bots.MiddlewareFuncs{
+		InboundFunc: func(ctx context.Context, activity *bots.Activity, next func(activity *bots.Activity)) {
+			r.add(name + " in")
+			next(activity)
+		},
+		OutboundFunc: func(ctx context.Context, activity *bots.Activity, next bots.OutboundFunc) (*bots.Identification, error) {
+			r.add(name + " before")
+			id, err := next(ctx, activity)
+			r.add(name + " after")
+			return id, err
+		},
+	}
+}
+
+func TestMiddlewareOutboundOrder(t *testing.T) {
+	fake := bottest.NewBot()
+	log := &recorder{}
+	bot := bots.NewMiddlewareBot(fake, log.middleware("a"), log.middleware("b"))
+	bot.Use(log.middleware("c"))
+	activity := fake.NewActivity(bots.TypeMessage, "hi")
+	want := []string{"a before", "b before", "c before", "c after", "b after", "a after"}
+
+	operations := map[string]func() error{
+		"send": func() error {
+			_, err := bot.Send(activity)
+			return err
+		},
+		"update": func() error {
+			_, err := bot.Update(activity)
+			return err
+		},
+		"delete": func() error {
+			return bot.Delete(activity)
+		},
+		"delete context": func() error {
+			return bot.DeleteContext(context.Background(), activity)
+		},
+	}
+
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			fake.Reset()
+
+			if err := operation(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := log.entries(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("middleware ran as %v, want %v", got, want)
+			}
+
+			if calls := fake.Calls(); len(calls) != 1 {
+				t.Fatalf("bot got %d calls, want 1", len(calls))
+			}
+		})
+	}
+}
+
+func TestMiddlewareOutboundShortCircuit(t *testing.T) {
+	errBlocked := errors.New("blocked")
+	fake := bottest.NewBot()
+	log := &recorder{}
+	block := &bots.MiddlewareFuncs{
+		OutboundFunc: func(ctx context.Context, activity *bots.Activity, next bots.OutboundFunc) (*bots.Identification, error) {
+			if strings.Contains(activity.Text, "secret") {
+				return nil, errBlocked
+			}
+
+			activity.Text = strings.ToUpper(activity.Text)
+			return next(ctx, activity)
+		},
+	}
+
+	bot := bots.NewMiddlewareBot(fake, log.middleware("a"), block, log.middleware("c"))
+
+	if _, err := bot.Send(fake.NewActivity(bots.TypeMessage, "secret")); err != errBlocked {
+		t.Fatalf("Send = %v, want %v", err, errBlocked)
+	}
+
+	if err := bot.Delete(fake.NewActivity(bots.TypeMessage, "secret")); err != errBlocked {
+		t.Fatalf("Delete = %v, want %v", err, errBlocked)
+	}
+
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("blocked activities reached the bot: %+v", calls)
+	}
+
+	if got, want := log.entries(), []string{"a before", "a after", "a before", "a after"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("middleware ran as %v, want %v", got, want)
+	}
+
+	if _, err := bot.Send(fake.NewActivity(bots.TypeMessage, "hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := fake.Sent(); len(sent) != 1 || sent[0].Text != "HELLO" {
+		t.Fatalf("unexpected sent activities %+v", sent)
+	}
+}
+
+func TestMiddlewareInbound(t *testing.T) {
+	fake := bottest.NewBot()
+	log := &recorder{}
+	drop := &bots.MiddlewareFuncs{
+		InboundFunc: func(ctx context.Context, activity *bots.Activity, next func(activity *bots.Activity)) {
+			if activity.Text == "spam" {
+				return
+			}
+
+			next(activity)
+		},
+	}
+
+	bot := bots.NewMiddlewareBot(fake, log.middleware("a"), drop, log.middleware("c"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := bot.GetUpdatesChannelContext(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"spam", "hi"} {
+		if _, err := fake.Say(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case activity := <-updates:
+		if activity.Text != "hi" {
+			t.Fatalf("unexpected activity %+v", activity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no activity delivered")
+	}
+
+	if got, want := log.entries(), []string{"a in", "a in", "c in"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("middleware ran as %v, want %v", got, want)
+	}
+
+	cancel()
+
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Fatal("unexpected activity after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("updates channel was not closed")
+	}
+}
@@ -1,6 +1,12 @@
 package bots
 
-import "net/http"
+import (
+	"context"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
 
 type Bot interface {
 	http.Handler
@@ -12,6 +18,20 @@ type Bot interface {
 	GetChannels() []string
 }
 
+type ContextBot interface {
+	Bot
+	SendContext(ctx context.Context, activity *Activity) (*Identification, error)
+	UpdateContext(ctx context.Context, activity *Activity) (*Identification, error)
+	DeleteContext(ctx context.Context, activity *Activity) error
+	GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error)
+	GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error)
+}
+
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+	Close() error
+}
+
 type Identification struct {
 	Id string `json:"id,omitempty"`
 }
@@ -50,25 +70,48 @@ const (
 	ChannelLine     = "line"
 	ChannelWebChat  = "webchat"
 	ChannelFacebook = "facebook"
+	ChannelSlack    = "slack"
+	ChannelDiscord  = "discord"
+	ChannelWhatsApp = "whatsapp"
+	ChannelConsole  = "console"
 
-	TypeHeroCard = "application/vnd.microsoft.card.hero"
+	TypeHeroCard       = "application/vnd.microsoft.card.hero"
+	TypeGeoCoordinates = "application/vnd.geo.coordinates"
 )
 
 type Activity struct {
 	Identification
-	Text             string               `json:"text,omitempty"`
-	From             *ChannelAccount      `json:"from"`
-	Conversation     *ConversationAccount `json:"conversation,omitempty"`
-	ServiceUrl       string               `json:"serviceUrl"`
-	ChannelData      interface{}          `json:"channelData,omitempty"`
-	ChannelId        string               `json:"channelId,omitempty"`
-	Recipient        *ChannelAccount      `json:"recipient"`
-	Type             ActivityType         `json:"type"`
-	InputHint        string               `json:"inputHint,omitempty"`
-	Attachments      []*Attachment        `json:"attachments,omitempty"`
-	TextFormat       TextFormat           `json:"textFormat,omitempty"`
-	ReplyToId        string               `json:"replyToId,omitempty"`
-	SuggestedActions *SuggestedActions    `json:"suggestedActions,omitempty"`
+	Text             string                 `json:"text,omitempty"`
+	From             *ChannelAccount        `json:"from"`
+	Conversation     *ConversationAccount   `json:"conversation,omitempty"`
+	ServiceUrl       string                 `json:"serviceUrl"`
+	ChannelData      interface{}            `json:"channelData,omitempty"`
+	ChannelId        string                 `json:"channelId,omitempty"`
+	Recipient        *ChannelAccount        `json:"recipient"`
+	Type             ActivityType           `json:"type"`
+	InputHint        string                 `json:"inputHint,omitempty"`
+	Attachments      []*Attachment          `json:"attachments,omitempty"`
+	TextFormat       TextFormat             `json:"textFormat,omitempty"`
+	ReplyToId        string                 `json:"replyToId,omitempty"`
+	SuggestedActions *SuggestedActions      `json:"suggestedActions,omitempty"`
+	MembersAdded     []*ChannelAccount      `json:"membersAdded,omitempty"`
+	MembersRemoved   []*ChannelAccount      `json:"membersRemoved,omitempty"`
+	Action           string                 `json:"action,omitempty"`
+	Name             string                 `json:"name,omitempty"`
+	Value            interface{}            `json:"value,omitempty"`
+	Annotations      map[string]interface{} `json:"-"`
+}
+
+func (a *Activity) Annotate(key string, value interface{}) {
+	if a.Annotations == nil {
+		a.Annotations = make(map[string]interface{})
+	}
+
+	a.Annotations[key] = value
+}
+
+func (a *Activity) Annotation(key string) interface{} {
+	return a.Annotations[key]
 }
 
 func (a *Activity) Response(message string) *Activity {
@@ -84,6 +127,48 @@ func (a *Activity) Response(message string) *Activity {
 	return &response
 }
 
+func targetConversationId(activity *Activity) string {
+	if activity.Conversation != nil && activity.Conversation.Id != "" {
+		return activity.Conversation.Id
+	}
+
+	if activity.Recipient != nil {
+		return activity.Recipient.Id
+	}
+
+	return ""
+}
+
+func targetUserId(activity *Activity) string {
+	if activity.Recipient != nil && activity.Recipient.Id != "" {
+		return activity.Recipient.Id
+	}
+
+	return targetConversationId(activity)
+}
+
+var defaultMediaTypes = map[string]string{
+	"image": "image/jpeg",
+	"video": "video/mp4",
+	"audio": "audio/mp4",
+}
+
+// mediaType turns a platform's media kind (image, video, audio or file) into
+// a MIME type, using the file name's extension when it agrees with the kind.
+func mediaType(kind, name string) string {
+	t, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+
+	if t != "" && (strings.HasPrefix(t, kind+"/") || kind == "file") {
+		return t
+	}
+
+	if t, ok := defaultMediaTypes[kind]; ok {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
 type ChannelAccount struct {
 	Identification
 	Name string `json:"name"`
@@ -128,6 +213,13 @@ type HeroCard struct {
 	Text    string        `json:"text,omitempty"`
 }
 
+type GeoCoordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
 type SuggestedActions struct {
 	Actions []*CardAction `json:"actions"`
 	To      []string      `json:"to,omitempty"`
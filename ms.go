@@ -1,21 +1,23 @@
 package bots
 
 import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/nickalie/bots/utils"
 	"github.com/parnurzeal/gorequest"
 )
 
 const UserAgent = "Microsoft-BotFramework/3.1 (MSBot Golang)"
 
+var errMSNoConversation = errors.New("msbot: activity has no conversation")
+
 type MSBotEndpoint struct {
 	RefreshEndpoint            string
 	RefreshScope               string
@@ -25,74 +27,159 @@ type MSBotEndpoint struct {
 	EmulatorOpenIdMetadata     string
 	EmulatorIssuers            []string
 	EmulatorAudience           string
-	StateEndpoint              string
+	TenantOpenIdMetadata       string
+	TenantIssuers              []string
+
+	// Deprecated: the State service is retired, use BotState with a Storage.
+	StateEndpoint string
 }
 
 type MSBotSettings struct {
-	AppId            string
-	AppPassword      string
-	GzipData         bool
-	Endpoint         *MSBotEndpoint
-	StateEndpoint    string
-	OpenIdMetadata   string
-	ValidateRequests bool
-	Channels         []string
+	AppId                 string
+	AppPassword           string
+	AppType               MSBotAppType
+	TenantId              string
+	Certificate           *x509.Certificate
+	PrivateKey            *rsa.PrivateKey
+	Cloud                 *MSBotCloud
+	GzipData              bool
+	Endpoint              *MSBotEndpoint
+	OpenIdMetadata        string
+	ValidateRequests      bool
+	Channels              []string
+	RateLimit             *RateLimit
+	ConversationRateLimit *RateLimit
+	Retry                 *RetryPolicy
+	TokenSource           TokenSource
+	SigningAlgorithms     []string
+	ClockSkew             time.Duration
+	OnAuthFailure         func(r *http.Request, activity *Activity, err *AuthError)
+
+	// Deprecated: the State service is retired, use BotState with a Storage.
+	StateEndpoint string
 }
 
 type MSBot struct {
 	settings                   *MSBotSettings
 	botConnectorOpenIdMetadata *OpenIdMetadata
 	emulatorOpenIdMetadata     *OpenIdMetadata
-	accessToken                string
-	accessTokenExpires         int64
+	tenantOpenIdMetadata       *OpenIdMetadata
+	tokens                     *tokenManager
 	updatesChannel             chan *Activity
+	lifecycle                  *lifecycle
+	limiter                    *rateLimiter
 }
 
+// NewMSBot never fails: invalid settings are reported by every outbound call
+// instead. Use NewMSBotE to get the error up front.
 func NewMSBot(settings *MSBotSettings) *MSBot {
 	if settings == nil {
 		settings = &MSBotSettings{}
 	}
 
-	if settings.Endpoint == nil {
+	err := settings.validate()
+	result := newMSBot(settings)
 
-		openIdMetadata := settings.OpenIdMetadata
+	if err != nil {
+		result.tokens.stop()
+		result.tokens = newTokenManager(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+			return nil, err
+		}))
+	}
+
+	return result
+}
 
-		if openIdMetadata == "" {
-			openIdMetadata = "https://login.botframework.com/v1/.well-known/openidconfiguration"
+func NewMSBotE(settings *MSBotSettings) (*MSBot, error) {
+	if settings == nil {
+		settings = &MSBotSettings{}
+	}
+
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+
+	return newMSBot(settings), nil
+}
+
+func (s *MSBotSettings) validate() error {
+	switch s.AppType {
+	case "", AppTypeMultiTenant:
+	case AppTypeSingleTenant:
+		if s.TenantId == "" {
+			return errors.New("NewMSBot: SingleTenant app type requires TenantId")
 		}
+	default:
+		return errors.New(fmt.Sprintf("NewMSBot: unknown app type %q", s.AppType))
+	}
+
+	if (s.Certificate == nil) != (s.PrivateKey == nil) {
+		return errors.New("NewMSBot: Certificate and PrivateKey must be set together")
+	}
 
+	return nil
+}
+
+func newMSBot(settings *MSBotSettings) *MSBot {
+	if settings.Cloud == nil {
+		settings.Cloud = PublicCloud
+	}
+
+	if settings.Endpoint == nil {
 		stateEndpoint := settings.StateEndpoint
 
 		if stateEndpoint == "" {
 			stateEndpoint = "https://state.botframework.com"
 		}
 
-		settings.Endpoint = &MSBotEndpoint{
-			RefreshEndpoint:            "https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token",
-			RefreshScope:               "https://api.botframework.com/.default",
-			BotConnectorOpenIdMetadata: openIdMetadata,
-			BotConnectorIssuers:        []string{"https://api.botframework.com"},
-			BotConnectorAudience:       settings.AppId,
-			EmulatorOpenIdMetadata:     "https://login.microsoftonline.com/botframework.com/v2.0/.well-known/openid-configuration",
-			EmulatorAudience:           settings.AppId,
-			EmulatorIssuers: []string{"https://sts.windows.net/d6d49420-f39b-4df7-a1dc-d59a935871db/",
-				"https://login.microsoftonline.com/d6d49420-f39b-4df7-a1dc-d59a935871db/v2.0",
-				"https://sts.windows.net/f8cdef31-a31e-4b4a-93e4-5f571e91255a/",
-				"https://login.microsoftonline.com/f8cdef31-a31e-4b4a-93e4-5f571e91255a/v2.0"},
-			StateEndpoint: stateEndpoint,
+		settings.Endpoint = settings.Cloud.Endpoint(settings)
+		settings.Endpoint.StateEndpoint = stateEndpoint
+	}
+
+	if settings.Retry == nil {
+		settings.Retry = defaultRetryPolicy()
+	}
+
+	if settings.TokenSource == nil && settings.Certificate != nil {
+		settings.TokenSource = &CertificateCredentials{
+			TokenURL:    settings.Endpoint.RefreshEndpoint,
+			ClientId:    settings.AppId,
+			Certificate: settings.Certificate,
+			PrivateKey:  settings.PrivateKey,
+			Scope:       settings.Endpoint.RefreshScope,
+		}
+	} else if settings.TokenSource == nil {
+		settings.TokenSource = &ClientCredentials{
+			TokenURL:     settings.Endpoint.RefreshEndpoint,
+			ClientId:     settings.AppId,
+			ClientSecret: settings.AppPassword,
+			Scope:        settings.Endpoint.RefreshScope,
 		}
 	}
 
-	return &MSBot{
+	result := &MSBot{
 		settings:                   settings,
 		botConnectorOpenIdMetadata: NewOpenIdMetadata(settings.Endpoint.BotConnectorOpenIdMetadata),
 		emulatorOpenIdMetadata:     NewOpenIdMetadata(settings.Endpoint.EmulatorOpenIdMetadata),
 		updatesChannel:             make(chan *Activity),
+		lifecycle:                  newLifecycle(),
+		limiter:                    newRateLimiter(settings.RateLimit, settings.ConversationRateLimit),
+		tokens:                     newTokenManager(settings.TokenSource),
+	}
+
+	if settings.Endpoint.TenantOpenIdMetadata != "" {
+		result.tenantOpenIdMetadata = NewOpenIdMetadata(settings.Endpoint.TenantOpenIdMetadata)
 	}
+
+	return result
 }
 
 func (b *MSBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
-	return b.authenticatedRequest(gorequest.New().Get(attachment.ContentUrl), false)
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *MSBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.authenticatedRequest(ctx, "", gorequest.New().Get(attachment.ContentUrl), false)
 }
 
 func (b *MSBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -106,112 +193,36 @@ func (b *MSBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+
 	defer r.Body.Close()
 	incoming := Activity{}
 	decoder := json.NewDecoder(r.Body)
 	decoder.Decode(&incoming)
 
 	if b.settings.ValidateRequests {
-		isEmulator := incoming.ChannelId == "emulator"
-		var token string
-		authHeaderValue := r.Header.Get("authorization")
-
-		if authHeaderValue == "" {
-			authHeaderValue = r.Header.Get("Authorization")
-		}
-
-		if authHeaderValue != "" {
-			auth := strings.Split(strings.Trim(authHeaderValue, " "), " ")
-
-			if len(auth) == 2 && strings.ToLower(auth[0]) == "bearer" {
-				token = auth[1]
+		if err := b.authenticate(r, &incoming); err != nil {
+			if b.settings.OnAuthFailure != nil {
+				b.settings.OnAuthFailure(r, &incoming, err)
 			}
-		}
 
-		if token != "" {
-			if !b.validateToken(token, &incoming, isEmulator, w) {
-				return
-			}
-		} else if isEmulator && b.settings.AppId != "" && b.settings.AppPassword != "" {
-			errorResponse(w, "invalid token")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("invalid token"))
 			return
 		}
 	}
 
-	b.updatesChannel <- &incoming
-	w.WriteHeader(http.StatusOK)
-}
-
-func (b *MSBot) validateToken(token string, incoming *Activity, isEmulator bool, w http.ResponseWriter) bool {
-	var openIDMetadata *OpenIdMetadata
-
-	if isEmulator {
-		openIDMetadata = b.emulatorOpenIdMetadata
-	} else {
-		openIDMetadata = b.botConnectorOpenIdMetadata
-	}
-
-	decoded, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		kid := utils.GetString(token.Header, "kid")
-		return openIDMetadata.GetKey(kid)
-	})
-
-	if err != nil {
-		fmt.Printf("jwt.Parse: %v\n", err)
-		errorResponse(w, "invalid token")
-		return false
-	}
-
-	if decoded == nil {
-		fmt.Println("decoded token is null")
-		errorResponse(w, "invalid token")
-		return false
-	}
-
-	claims, ok := decoded.Claims.(jwt.MapClaims)
-
-	if !ok {
-		fmt.Println("unable to get claims")
-		errorResponse(w, "invalid token")
-		return false
-	}
-
-	var issuers []string
-
-	if isEmulator {
-		issuers = b.settings.Endpoint.EmulatorIssuers
-	} else {
-		issuers = b.settings.Endpoint.BotConnectorIssuers
-	}
-
-	validIssuer := false
-
-	for _, v := range issuers {
-		if claims.VerifyIssuer(v, true) {
-			validIssuer = true
-			break
-		}
-	}
-
-	if !validIssuer {
-		fmt.Println("invalid issuer")
-		errorResponse(w, "invalid token")
-		return false
-	}
-
-	if !claims.VerifyAudience(b.settings.AppId, true) {
-		fmt.Println("invalid audience")
-		errorResponse(w, "invalid token")
-		return false
-	}
-
-	if !isEmulator && utils.GetString(claims, "serviceurl") != incoming.ServiceUrl {
-		fmt.Println("invalid serviceUrl")
-		errorResponse(w, "invalid token")
-		return false
+	if !b.lifecycle.deliver(b.updatesChannel, &incoming) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
 	}
 
-	return true
+	w.WriteHeader(http.StatusOK)
 }
 
 func errorResponse(w http.ResponseWriter, message string) {
@@ -219,16 +230,23 @@ func errorResponse(w http.ResponseWriter, message string) {
 	w.Write([]byte(message))
 }
 
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
 func (b *MSBot) Send(activity *Activity) (*Identification, error) {
-	activity = fixActivity(activity)
-	path := "v3/conversations/" + url.QueryEscape(activity.Conversation.Id) + "/activities"
+	return b.SendContext(context.Background(), activity)
+}
 
-	if activity.ReplyToId != "" {
-		path += "/" + url.QueryEscape(activity.ReplyToId)
+func (b *MSBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if activity.Conversation == nil {
+		return nil, errMSNoConversation
 	}
 
-	request := gorequest.New().Post(activity.ServiceUrl + "/" + path).Send(activity)
-	resp, err := b.authenticatedRequest(request, false)
+	activity = fixActivity(activity)
+	request := gorequest.New().Post(connectorUrl(activity.ServiceUrl, activity.Conversation.Id, "activities", activity.ReplyToId)).Send(activity)
+	resp, err := b.authenticatedRequest(ctx, activity.Conversation.Id, request, false)
 
 	if err != nil {
 		return nil, err
@@ -242,15 +260,17 @@ func (b *MSBot) Send(activity *Activity) (*Identification, error) {
 }
 
 func (b *MSBot) Update(activity *Activity) (*Identification, error) {
-	activity = fixActivity(activity)
-	path := "/v3/conversations/" + url.QueryEscape(activity.Conversation.Id) + "/activities"
+	return b.UpdateContext(context.Background(), activity)
+}
 
-	if activity.Id != "" {
-		path += "/" + url.QueryEscape(activity.Id)
+func (b *MSBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if activity.Conversation == nil {
+		return nil, errMSNoConversation
 	}
 
-	request := gorequest.New().Put(activity.ServiceUrl + "/" + path).Send(activity)
-	resp, err := b.authenticatedRequest(request, false)
+	activity = fixActivity(activity)
+	request := gorequest.New().Put(connectorUrl(activity.ServiceUrl, activity.Conversation.Id, "activities", activity.Id)).Send(activity)
+	resp, err := b.authenticatedRequest(ctx, activity.Conversation.Id, request, false)
 
 	if err != nil {
 		return nil, err
@@ -264,39 +284,43 @@ func (b *MSBot) Update(activity *Activity) (*Identification, error) {
 }
 
 func (b *MSBot) Delete(activity *Activity) error {
-	path := "/v3/conversations/" + url.QueryEscape(activity.Conversation.Id) + "/activities"
+	return b.DeleteContext(context.Background(), activity)
+}
 
-	if activity.Id != "" {
-		path += "/" + url.QueryEscape(activity.Id)
+func (b *MSBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	if activity.Conversation == nil {
+		return errMSNoConversation
 	}
 
-	request := gorequest.New().Delete(activity.ServiceUrl + "/" + path).Send(activity)
-	_, err := b.authenticatedRequest(request, false)
+	request := gorequest.New().Delete(connectorUrl(activity.ServiceUrl, activity.Conversation.Id, "activities", activity.Id)).Send(activity)
+	_, err := b.authenticatedRequest(ctx, activity.Conversation.Id, request, false)
 	return err
 }
 
-func (b *MSBot) authenticatedRequest(request *gorequest.SuperAgent, refresh bool) (*http.Response, error) {
-	if refresh {
-		b.accessToken = ""
-	}
-
+func (b *MSBot) authenticatedRequest(ctx context.Context, conversationId string, request *gorequest.SuperAgent, refresh bool) (*http.Response, error) {
 	b.addUserAgent(request)
-	err := b.addAccessToken(request)
+	token, err := b.addAccessToken(ctx, request)
 
 	if err != nil {
 		return nil, err
 	}
 
-	resp, body, errs := request.End()
+	resp, body, err := b.settings.Retry.do(ctx, func() (*http.Response, []byte, error) {
+		if err := b.limiter.wait(ctx, conversationId); err != nil {
+			return nil, nil, err
+		}
+
+		return endRequest(ctx, request)
+	}, retryableFor(request.Method))
 
-	if len(errs) > 0 {
-		errs = append(errs, errors.New(string(body)))
-		return resp, utils.ErrorFromArray(errs)
+	if err != nil {
+		return resp, err
 	}
 
 	if resp.StatusCode == 401 || resp.StatusCode == 403 {
 		if !refresh {
-			return b.authenticatedRequest(request, true)
+			b.tokens.invalidate(token)
+			return b.authenticatedRequest(ctx, conversationId, request, true)
 		}
 	} else if resp.StatusCode < 400 {
 		return resp, nil
@@ -305,78 +329,49 @@ func (b *MSBot) authenticatedRequest(request *gorequest.SuperAgent, refresh bool
 	return resp, errors.New(fmt.Sprintf("authenticatedRequest failed: %s %d", body, resp.StatusCode))
 }
 
-func (b *MSBot) addAccessToken(request *gorequest.SuperAgent) error {
-	token, err := b.getAccessToken()
+func (b *MSBot) addAccessToken(ctx context.Context, request *gorequest.SuperAgent) (*Token, error) {
+	token, err := b.tokens.Token(ctx)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	request.Set("Authorization", "Bearer "+token)
-	return nil
+	request.Set("Authorization", "Bearer "+token.AccessToken)
+	return token, nil
 }
 
 func (b *MSBot) addUserAgent(request *gorequest.SuperAgent) {
 	request.Set("User-Agent", UserAgent)
 }
 
-func (b *MSBot) tokenExpired() bool {
-	return time.Now().Unix() >= b.accessTokenExpires
+func (b *MSBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.updatesChannel, nil
 }
 
-func (b *MSBot) tokenHalfWayExpired() bool {
-	var secondsToHalfWayExpire int64 = 1800
-	var secondsToExpire int64 = 300
-	var timeToExpiration = (b.accessTokenExpires - time.Now().Unix()) / 1000
-	return timeToExpiration < secondsToHalfWayExpire && timeToExpiration > secondsToExpire
+func (b *MSBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	return forwardUpdates(ctx, b.updatesChannel), nil
 }
 
-func (b *MSBot) getAccessToken() (string, error) {
-	if b.accessToken == "" || b.tokenExpired() {
-		return b.refreshAccessToken()
-	} else if b.tokenHalfWayExpired() {
-		oldToken := b.accessToken
-		_, err := b.refreshAccessToken()
-
-		if err == nil {
-			return b.accessToken, nil
-		} else {
-			return oldToken, nil
-		}
-	} else {
-		return b.accessToken, nil
-	}
-}
+func (b *MSBot) Shutdown(ctx context.Context) error {
+	err := b.lifecycle.shutdown(ctx, b.updatesChannel)
 
-func (b *MSBot) refreshAccessToken() (string, error) {
-	r := gorequest.New().Post(b.settings.Endpoint.RefreshEndpoint)
-	r.Type("multipart")
-	r.Send(map[string]string{
-		"grant_type":    "client_credentials",
-		"client_id":     b.settings.AppId,
-		"client_secret": b.settings.AppPassword,
-		"scope":         b.settings.Endpoint.RefreshScope,
-	})
-
-	b.addUserAgent(r)
-	oauthResponse := OAuthResponse{}
-	resp, _, errs := r.EndStruct(&oauthResponse)
-
-	if len(errs) > 0 {
-		return "", errs[0]
-	}
+	if err != ErrBotClosed {
+		b.tokens.stop()
+		b.botConnectorOpenIdMetadata.Close()
+		b.emulatorOpenIdMetadata.Close()
 
-	if resp.StatusCode >= 300 {
-		return "", errors.New(fmt.Sprintf("Refresh access token failed with status code: %d", resp.StatusCode))
+		if b.tenantOpenIdMetadata != nil {
+			b.tenantOpenIdMetadata.Close()
+		}
 	}
 
-	b.accessToken = oauthResponse.AccessToken
-	b.accessTokenExpires = time.Now().Unix() - oauthResponse.ExpiresIn + 300
-	return b.accessToken, nil
+	return err
 }
 
-func (b *MSBot) GetUpdatesChannel() (<-chan *Activity, error) {
-	return b.updatesChannel, nil
+func (b *MSBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
 }
 
 func (b *MSBot) GetChannels() []string {
@@ -0,0 +1,242 @@
+package bots
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nickalie/bots/utils"
+)
+
+const DefaultClockSkew = 5 * time.Minute
+
+var DefaultSigningAlgorithms = []string{"RS256", "RS384", "RS512"}
+
+type AuthFailureReason string
+
+const (
+	AuthMissingToken        = AuthFailureReason("missingToken")
+	AuthMalformedToken      = AuthFailureReason("malformedToken")
+	AuthDisallowedAlgorithm = AuthFailureReason("disallowedAlgorithm")
+	AuthUnknownKey          = AuthFailureReason("unknownKey")
+	AuthInvalidSignature    = AuthFailureReason("invalidSignature")
+	AuthExpired             = AuthFailureReason("expired")
+	AuthNotYetValid         = AuthFailureReason("notYetValid")
+	AuthInvalidIssuer       = AuthFailureReason("invalidIssuer")
+	AuthInvalidAudience     = AuthFailureReason("invalidAudience")
+	AuthInvalidAppId        = AuthFailureReason("invalidAppId")
+	AuthNotEndorsed         = AuthFailureReason("notEndorsed")
+	AuthInvalidServiceUrl   = AuthFailureReason("invalidServiceUrl")
+)
+
+type AuthError struct {
+	Reason AuthFailureReason
+	Err    error
+}
+
+func (e *AuthError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+	}
+
+	return string(e.Reason)
+}
+
+func authError(reason AuthFailureReason, format string, args ...interface{}) *AuthError {
+	return &AuthError{Reason: reason, Err: errors.New(fmt.Sprintf(format, args...))}
+}
+
+func (b *MSBot) authenticate(r *http.Request, incoming *Activity) *AuthError {
+	isEmulator := incoming.ChannelId == "emulator"
+	var token string
+	authHeaderValue := r.Header.Get("Authorization")
+
+	if authHeaderValue != "" {
+		auth := strings.Split(strings.Trim(authHeaderValue, " "), " ")
+
+		if len(auth) == 2 && strings.ToLower(auth[0]) == "bearer" {
+			token = auth[1]
+		}
+	}
+
+	if token != "" {
+		return b.validateToken(token, incoming, isEmulator)
+	}
+
+	if b.settings.AppId != "" {
+		return &AuthError{Reason: AuthMissingToken}
+	}
+
+	return nil
+}
+
+func (b *MSBot) validateToken(token string, incoming *Activity, isEmulator bool) *AuthError {
+	var openIDMetadata *OpenIdMetadata
+	var issuers []string
+	var audience string
+	isTenant := !isEmulator && b.tenantOpenIdMetadata != nil &&
+		containsString(b.settings.Endpoint.TenantIssuers, unverifiedIssuer(token))
+
+	if isEmulator {
+		openIDMetadata = b.emulatorOpenIdMetadata
+		issuers = b.settings.Endpoint.EmulatorIssuers
+		audience = b.settings.Endpoint.EmulatorAudience
+	} else if isTenant {
+		openIDMetadata = b.tenantOpenIdMetadata
+		issuers = b.settings.Endpoint.TenantIssuers
+		audience = b.settings.Endpoint.BotConnectorAudience
+	} else {
+		openIDMetadata = b.botConnectorOpenIdMetadata
+		issuers = b.settings.Endpoint.BotConnectorIssuers
+		audience = b.settings.Endpoint.BotConnectorAudience
+	}
+
+	if audience == "" {
+		audience = b.settings.AppId
+	}
+
+	algorithms := b.settings.SigningAlgorithms
+
+	if len(algorithms) == 0 {
+		algorithms = DefaultSigningAlgorithms
+	}
+
+	var key *OpenIdKey
+	var keyErr *AuthError
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+
+	decoded, err := parser.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		alg := utils.GetString(token.Header, "alg")
+
+		if !containsString(algorithms, alg) {
+			keyErr = authError(AuthDisallowedAlgorithm, "algorithm %q is not allowed", alg)
+			return nil, keyErr
+		}
+
+		kid := utils.GetString(token.Header, "kid")
+		k, err := openIDMetadata.GetSigningKey(kid)
+
+		if err != nil {
+			keyErr = &AuthError{Reason: AuthUnknownKey, Err: err}
+			return nil, keyErr
+		}
+
+		if k.Algorithm != "" && k.Algorithm != alg {
+			keyErr = authError(AuthDisallowedAlgorithm, "key %s is for %s, token uses %s", kid, k.Algorithm, alg)
+			return nil, keyErr
+		}
+
+		key = k
+		return k.Key, nil
+	})
+
+	if keyErr != nil {
+		return keyErr
+	}
+
+	if err != nil {
+		if e, ok := err.(*jwt.ValidationError); ok && e.Errors&jwt.ValidationErrorMalformed != 0 {
+			return &AuthError{Reason: AuthMalformedToken, Err: err}
+		}
+
+		return &AuthError{Reason: AuthInvalidSignature, Err: err}
+	}
+
+	claims, ok := decoded.Claims.(jwt.MapClaims)
+
+	if !ok {
+		return authError(AuthMalformedToken, "unable to get claims")
+	}
+
+	skew := b.settings.ClockSkew
+
+	if skew == 0 {
+		skew = DefaultClockSkew
+	}
+
+	now := time.Now()
+
+	if !claims.VerifyExpiresAt(now.Add(-skew).Unix(), true) {
+		return authError(AuthExpired, "token is expired")
+	}
+
+	if !claims.VerifyNotBefore(now.Add(skew).Unix(), false) {
+		return authError(AuthNotYetValid, "token is not valid yet")
+	}
+
+	if isEmulator && len(issuers) == 0 {
+		issuers = metadataIssuers(b.settings.Cloud, openIDMetadata.currentIssuer())
+	}
+
+	validIssuer := false
+
+	for _, v := range issuers {
+		if claims.VerifyIssuer(v, true) {
+			validIssuer = true
+			break
+		}
+	}
+
+	if !validIssuer {
+		return authError(AuthInvalidIssuer, "invalid issuer %q", utils.GetString(claims, "iss"))
+	}
+
+	if !claims.VerifyAudience(audience, true) {
+		return authError(AuthInvalidAudience, "invalid audience")
+	}
+
+	if isEmulator {
+		return b.validateAppId(claims)
+	}
+
+	if isTenant {
+		if err := b.validateAppId(claims); err != nil {
+			return err
+		}
+
+		return validateServiceUrl(claims, incoming)
+	}
+
+	if !key.Endorsed(incoming.ChannelId) {
+		return authError(AuthNotEndorsed, "channel %q is not endorsed by key %s", incoming.ChannelId, key.KeyId)
+	}
+
+	return validateServiceUrl(claims, incoming)
+}
+
+func (b *MSBot) validateAppId(claims jwt.MapClaims) *AuthError {
+	appId := utils.GetString(claims, "appid")
+
+	if appId == "" {
+		appId = utils.GetString(claims, "azp")
+	}
+
+	if appId == "" || appId != b.settings.AppId {
+		return authError(AuthInvalidAppId, "invalid app id %q", appId)
+	}
+
+	return nil
+}
+
+func validateServiceUrl(claims jwt.MapClaims, incoming *Activity) *AuthError {
+	serviceUrl := utils.GetString(claims, "serviceurl")
+
+	if serviceUrl == "" || serviceUrl != incoming.ServiceUrl {
+		return authError(AuthInvalidServiceUrl, "invalid serviceUrl %q", incoming.ServiceUrl)
+	}
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
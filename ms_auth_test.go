@@ -0,0 +1,273 @@
+package bots_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/msbottest"
+)
+
+func TestMSBotTokenValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		channel      string
+		endorsements []string
+		claims       func(claims jwt.MapClaims)
+		token        func(token string) string
+		reason       bots.AuthFailureReason
+	}{
+		{name: "valid"},
+		{name: "missing token", token: func(string) string { return "" }, reason: bots.AuthMissingToken},
+		{name: "tampered signature", token: func(token string) string { return token[:len(token)-4] + "AAAA" }, reason: bots.AuthInvalidSignature},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://example.com" }, reason: bots.AuthInvalidIssuer},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "other" }, reason: bots.AuthInvalidAudience},
+		{name: "wrong service url", claims: func(c jwt.MapClaims) { c["serviceurl"] = "https://example.com" }, reason: bots.AuthInvalidServiceUrl},
+		{name: "missing service url", claims: func(c jwt.MapClaims) { delete(c, "serviceurl") }, reason: bots.AuthInvalidServiceUrl},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-10 * time.Minute).Unix() }, reason: bots.AuthExpired},
+		{name: "expired within clock skew", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "not yet valid", claims: func(c jwt.MapClaims) { c["nbf"] = time.Now().Add(10 * time.Minute).Unix() }, reason: bots.AuthNotYetValid},
+		{name: "not endorsed", channel: bots.ChannelSlack, endorsements: []string{bots.ChannelWebChat}, reason: bots.AuthNotEndorsed},
+		{name: "no endorsements", endorsements: []string{}, reason: bots.AuthNotEndorsed},
+		{name: "emulator", channel: "emulator", claims: func(c jwt.MapClaims) { c["appid"] = "app" }},
+		{name: "emulator azp", channel: "emulator", claims: func(c jwt.MapClaims) { c["azp"] = "app" }},
+		{name: "emulator wrong app id", channel: "emulator", claims: func(c jwt.MapClaims) { c["appid"] = "other" }, reason: bots.AuthInvalidAppId},
+		{name: "emulator missing app id", channel: "emulator", reason: bots.AuthInvalidAppId},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := msbottest.NewServer("app", "password")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer server.Close()
+
+			if tt.endorsements != nil {
+				server.Endorsements = tt.endorsements
+			}
+
+			var failure *bots.AuthError
+			settings := server.Settings()
+			settings.OnAuthFailure = func(r *http.Request, activity *bots.Activity, err *bots.AuthError) {
+				failure = err
+			}
+
+			bot := bots.NewMSBot(settings)
+			defer bot.Close()
+			activity := server.NewActivity("hi")
+
+			if tt.channel != "" {
+				activity.ChannelId = tt.channel
+			}
+
+			claims := jwt.MapClaims{
+				"iss":        msbottest.Issuer,
+				"aud":        server.AppId,
+				"serviceurl": activity.ServiceUrl,
+				"nbf":        time.Now().Add(-time.Minute).Unix(),
+				"exp":        time.Now().Add(time.Hour).Unix(),
+			}
+
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+
+			token, err := server.Sign(claims)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.token != nil {
+				token = tt.token(token)
+			}
+
+			body, _ := json.Marshal(activity)
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			updates, _ := bot.GetUpdatesChannel()
+			received := make(chan *bots.Activity, 1)
+
+			go func() {
+				if m, ok := <-updates; ok {
+					received <- m
+				}
+			}()
+
+			w := httptest.NewRecorder()
+			bot.ServeHTTP(w, r)
+
+			if tt.reason == "" {
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d (%v)", w.Code, http.StatusOK, failure)
+				}
+
+				if m := <-received; m.Text != "hi" {
+					t.Fatalf("unexpected activity %+v", m)
+				}
+
+				return
+			}
+
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+
+			if failure == nil || failure.Reason != tt.reason {
+				t.Fatalf("failure = %v, want %s", failure, tt.reason)
+			}
+		})
+	}
+}
+
+func TestMSBotIssuerPaths(t *testing.T) {
+	const tenantIssuer = "https://login.example.com/tenant/v2.0"
+
+	tests := []struct {
+		name     string
+		settings func(s *bots.MSBotSettings)
+		channel  string
+		claims   func(claims jwt.MapClaims)
+		reason   bots.AuthFailureReason
+	}{
+		{
+			name:     "single tenant",
+			settings: singleTenant(tenantIssuer),
+			claims:   func(c jwt.MapClaims) { c["iss"], c["appid"] = tenantIssuer, "app" },
+		},
+		{
+			name:     "single tenant azp",
+			settings: singleTenant(tenantIssuer),
+			claims:   func(c jwt.MapClaims) { c["iss"], c["azp"] = tenantIssuer, "app" },
+		},
+		{
+			name:     "single tenant wrong app id",
+			settings: singleTenant(tenantIssuer),
+			claims:   func(c jwt.MapClaims) { c["iss"], c["appid"] = tenantIssuer, "other" },
+			reason:   bots.AuthInvalidAppId,
+		},
+		{
+			name:     "single tenant wrong service url",
+			settings: singleTenant(tenantIssuer),
+			claims: func(c jwt.MapClaims) {
+				c["iss"], c["appid"], c["serviceurl"] = tenantIssuer, "app", "https://example.com"
+			},
+			reason: bots.AuthInvalidServiceUrl,
+		},
+		{
+			name:     "single tenant accepts bot connector",
+			settings: singleTenant(tenantIssuer),
+		},
+		{
+			name:   "tenant issuer on multi tenant bot",
+			claims: func(c jwt.MapClaims) { c["iss"], c["appid"] = tenantIssuer, "app" },
+			reason: bots.AuthInvalidIssuer,
+		},
+		{
+			name:     "emulator issuer from metadata",
+			settings: func(s *bots.MSBotSettings) { s.Endpoint.EmulatorIssuers = nil },
+			channel:  "emulator",
+			claims:   func(c jwt.MapClaims) { c["appid"] = "app" },
+		},
+		{
+			name:     "emulator issuer not in metadata",
+			settings: func(s *bots.MSBotSettings) { s.Endpoint.EmulatorIssuers = nil },
+			channel:  "emulator",
+			claims:   func(c jwt.MapClaims) { c["iss"], c["appid"] = "https://example.com", "app" },
+			reason:   bots.AuthInvalidIssuer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := msbottest.NewServer("app", "password")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer server.Close()
+			var failure *bots.AuthError
+			settings := server.Settings()
+			settings.OnAuthFailure = func(r *http.Request, activity *bots.Activity, err *bots.AuthError) {
+				failure = err
+			}
+
+			if tt.settings != nil {
+				tt.settings(settings)
+			}
+
+			bot, err := bots.NewMSBotE(settings)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer bot.Close()
+			activity := server.NewActivity("hi")
+
+			if tt.channel != "" {
+				activity.ChannelId = tt.channel
+			}
+
+			claims := jwt.MapClaims{
+				"iss":        msbottest.Issuer,
+				"aud":        server.AppId,
+				"serviceurl": activity.ServiceUrl,
+				"exp":        time.Now().Add(time.Hour).Unix(),
+			}
+
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+
+			token, err := server.Sign(claims)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, _ := json.Marshal(activity)
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			r.Header.Set("Authorization", "Bearer "+token)
+			updates, _ := bot.GetUpdatesChannel()
+
+			go func() {
+				for range updates {
+				}
+			}()
+
+			w := httptest.NewRecorder()
+			bot.ServeHTTP(w, r)
+
+			if tt.reason == "" && w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (%v)", w.Code, http.StatusOK, failure)
+			}
+
+			if tt.reason != "" && (failure == nil || failure.Reason != tt.reason) {
+				t.Fatalf("failure = %v, want %s", failure, tt.reason)
+			}
+		})
+	}
+}
+
+func singleTenant(issuer string) func(s *bots.MSBotSettings) {
+	return func(s *bots.MSBotSettings) {
+		s.AppType = bots.AppTypeSingleTenant
+		s.TenantId = "tenant"
+		s.Endpoint.TenantOpenIdMetadata = s.Endpoint.BotConnectorOpenIdMetadata
+		s.Endpoint.TenantIssuers = []string{issuer}
+	}
+}
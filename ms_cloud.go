@@ -0,0 +1,133 @@
+package bots
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+type MSBotAppType string
+
+const (
+	AppTypeMultiTenant  = MSBotAppType("MultiTenant")
+	AppTypeSingleTenant = MSBotAppType("SingleTenant")
+)
+
+type MSBotCloud struct {
+	LoginEndpoint  string
+	STSEndpoint    string
+	DefaultTenant  string
+	Scope          string
+	OpenIdMetadata string
+	Issuer         string
+	AADIssuers     []string
+}
+
+var PublicCloud = &MSBotCloud{
+	LoginEndpoint:  "https://login.microsoftonline.com",
+	STSEndpoint:    "https://sts.windows.net",
+	DefaultTenant:  "botframework.com",
+	Scope:          "https://api.botframework.com/.default",
+	OpenIdMetadata: "https://login.botframework.com/v1/.well-known/openidconfiguration",
+	Issuer:         "https://api.botframework.com",
+	AADIssuers: []string{"https://sts.windows.net/d6d49420-f39b-4df7-a1dc-d59a935871db/",
+		"https://login.microsoftonline.com/d6d49420-f39b-4df7-a1dc-d59a935871db/v2.0",
+		"https://sts.windows.net/f8cdef31-a31e-4b4a-93e4-5f571e91255a/",
+		"https://login.microsoftonline.com/f8cdef31-a31e-4b4a-93e4-5f571e91255a/v2.0"},
+}
+
+var USGovCloud = &MSBotCloud{
+	LoginEndpoint:  "https://login.microsoftonline.us",
+	STSEndpoint:    "https://sts.windows.net",
+	DefaultTenant:  "MicrosoftServices.onmicrosoft.us",
+	Scope:          "https://api.botframework.us/.default",
+	OpenIdMetadata: "https://login.botframework.azure.us/v1/.well-known/openidconfiguration",
+	Issuer:         "https://api.botframework.us",
+	AADIssuers: []string{"https://sts.windows.net/cab8a31a-1906-4287-a0d8-4eef66b95f6e/",
+		"https://login.microsoftonline.us/cab8a31a-1906-4287-a0d8-4eef66b95f6e/v2.0"},
+}
+
+// ChinaCloud lists no AADIssuers: emulator tokens are checked against the
+// issuer published in the emulator OpenID metadata instead.
+var ChinaCloud = &MSBotCloud{
+	LoginEndpoint:  "https://login.chinacloudapi.cn",
+	STSEndpoint:    "https://sts.chinacloudapi.cn",
+	DefaultTenant:  "microsoftservices.partner.onmschina.cn",
+	Scope:          "https://api.botframework.azure.cn/.default",
+	OpenIdMetadata: "https://login.botframework.azure.cn/v1/.well-known/openidconfiguration",
+	Issuer:         "https://api.botframework.azure.cn",
+}
+
+func (c *MSBotCloud) Endpoint(settings *MSBotSettings) *MSBotEndpoint {
+	result := &MSBotEndpoint{
+		RefreshEndpoint:            c.LoginEndpoint + "/" + c.DefaultTenant + "/oauth2/v2.0/token",
+		RefreshScope:               c.Scope,
+		BotConnectorOpenIdMetadata: c.OpenIdMetadata,
+		BotConnectorIssuers:        []string{c.Issuer},
+		BotConnectorAudience:       settings.AppId,
+		EmulatorOpenIdMetadata:     c.LoginEndpoint + "/" + c.DefaultTenant + "/v2.0/.well-known/openid-configuration",
+		EmulatorIssuers:            c.AADIssuers,
+		EmulatorAudience:           settings.AppId,
+	}
+
+	if settings.OpenIdMetadata != "" {
+		result.BotConnectorOpenIdMetadata = settings.OpenIdMetadata
+	}
+
+	if settings.AppType == AppTypeSingleTenant {
+		result.RefreshEndpoint = c.LoginEndpoint + "/" + settings.TenantId + "/oauth2/v2.0/token"
+		result.TenantOpenIdMetadata = c.LoginEndpoint + "/" + settings.TenantId + "/v2.0/.well-known/openid-configuration"
+		result.TenantIssuers = tenantIssuers(c, settings.TenantId)
+	}
+
+	return result
+}
+
+func tenantIssuers(c *MSBotCloud, tenantId string) []string {
+	return []string{
+		c.STSEndpoint + "/" + tenantId + "/",
+		c.LoginEndpoint + "/" + tenantId + "/v2.0",
+	}
+}
+
+// metadataIssuers trusts the issuer published in the OpenID metadata, and
+// its v1 form, for clouds that do not list their AAD issuers.
+func metadataIssuers(c *MSBotCloud, issuer string) []string {
+	if issuer == "" {
+		return nil
+	}
+
+	result := []string{issuer}
+	prefix := c.LoginEndpoint + "/"
+
+	if c.STSEndpoint != "" && strings.HasPrefix(issuer, prefix) && strings.HasSuffix(issuer, "/v2.0") {
+		tenantId := strings.TrimSuffix(strings.TrimPrefix(issuer, prefix), "/v2.0")
+
+		if tenantId != "" && !strings.Contains(tenantId, "/") {
+			result = append(result, c.STSEndpoint+"/"+tenantId+"/")
+		}
+	}
+
+	return result
+}
+
+func unverifiedIssuer(token string) string {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+
+	json.Unmarshal(payload, &claims)
+	return claims.Issuer
+}
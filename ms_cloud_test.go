@@ -0,0 +1,110 @@
+package bots
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMSBotCloudEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		cloud    *MSBotCloud
+		settings *MSBotSettings
+		want     *MSBotEndpoint
+	}{
+		{
+			name:     "public",
+			cloud:    PublicCloud,
+			settings: &MSBotSettings{AppId: "app"},
+			want: &MSBotEndpoint{
+				RefreshEndpoint:            "https://login.microsoftonline.com/botframework.com/oauth2/v2.0/token",
+				RefreshScope:               "https://api.botframework.com/.default",
+				BotConnectorOpenIdMetadata: "https://login.botframework.com/v1/.well-known/openidconfiguration",
+				BotConnectorIssuers:        []string{"https://api.botframework.com"},
+				BotConnectorAudience:       "app",
+				EmulatorOpenIdMetadata:     "https://login.microsoftonline.com/botframework.com/v2.0/.well-known/openid-configuration",
+				EmulatorIssuers:            PublicCloud.AADIssuers,
+				EmulatorAudience:           "app",
+			},
+		},
+		{
+			name:     "public single tenant",
+			cloud:    PublicCloud,
+			settings: &MSBotSettings{AppId: "app", AppType: AppTypeSingleTenant, TenantId: "tenant"},
+			want: &MSBotEndpoint{
+				RefreshEndpoint:            "https://login.microsoftonline.com/tenant/oauth2/v2.0/token",
+				RefreshScope:               "https://api.botframework.com/.default",
+				BotConnectorOpenIdMetadata: "https://login.botframework.com/v1/.well-known/openidconfiguration",
+				BotConnectorIssuers:        []string{"https://api.botframework.com"},
+				BotConnectorAudience:       "app",
+				EmulatorOpenIdMetadata:     "https://login.microsoftonline.com/botframework.com/v2.0/.well-known/openid-configuration",
+				EmulatorIssuers:            PublicCloud.AADIssuers,
+				EmulatorAudience:           "app",
+				TenantOpenIdMetadata:       "https://login.microsoftonline.com/tenant/v2.0/.well-known/openid-configuration",
+				TenantIssuers:              []string{"https://sts.windows.net/tenant/", "https://login.microsoftonline.com/tenant/v2.0"},
+			},
+		},
+		{
+			name:     "us government",
+			cloud:    USGovCloud,
+			settings: &MSBotSettings{AppId: "app", OpenIdMetadata: "https://example.com/metadata"},
+			want: &MSBotEndpoint{
+				RefreshEndpoint:            "https://login.microsoftonline.us/MicrosoftServices.onmicrosoft.us/oauth2/v2.0/token",
+				RefreshScope:               "https://api.botframework.us/.default",
+				BotConnectorOpenIdMetadata: "https://example.com/metadata",
+				BotConnectorIssuers:        []string{"https://api.botframework.us"},
+				BotConnectorAudience:       "app",
+				EmulatorOpenIdMetadata:     "https://login.microsoftonline.us/MicrosoftServices.onmicrosoft.us/v2.0/.well-known/openid-configuration",
+				EmulatorIssuers:            USGovCloud.AADIssuers,
+				EmulatorAudience:           "app",
+			},
+		},
+		{
+			name:     "china single tenant",
+			cloud:    ChinaCloud,
+			settings: &MSBotSettings{AppId: "app", AppType: AppTypeSingleTenant, TenantId: "tenant"},
+			want: &MSBotEndpoint{
+				RefreshEndpoint:            "https://login.chinacloudapi.cn/tenant/oauth2/v2.0/token",
+				RefreshScope:               "https://api.botframework.azure.cn/.default",
+				BotConnectorOpenIdMetadata: "https://login.botframework.azure.cn/v1/.well-known/openidconfiguration",
+				BotConnectorIssuers:        []string{"https://api.botframework.azure.cn"},
+				BotConnectorAudience:       "app",
+				EmulatorOpenIdMetadata:     "https://login.chinacloudapi.cn/microsoftservices.partner.onmschina.cn/v2.0/.well-known/openid-configuration",
+				EmulatorAudience:           "app",
+				TenantOpenIdMetadata:       "https://login.chinacloudapi.cn/tenant/v2.0/.well-known/openid-configuration",
+				TenantIssuers:              []string{"https://sts.chinacloudapi.cn/tenant/", "https://login.chinacloudapi.cn/tenant/v2.0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cloud.Endpoint(tt.settings); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Endpoint() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataIssuers(t *testing.T) {
+	tests := []struct {
+		name   string
+		cloud  *MSBotCloud
+		issuer string
+		want   []string
+	}{
+		{"none", ChinaCloud, "", nil},
+		{"v2", ChinaCloud, "https://login.chinacloudapi.cn/tid/v2.0",
+			[]string{"https://login.chinacloudapi.cn/tid/v2.0", "https://sts.chinacloudapi.cn/tid/"}},
+		{"other host", ChinaCloud, "https://login.example.com/tid/v2.0", []string{"https://login.example.com/tid/v2.0"}},
+		{"not a tenant", PublicCloud, "https://api.botframework.com", []string{"https://api.botframework.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metadataIssuers(tt.cloud, tt.issuer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("metadataIssuers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package bots
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+type ConversationParameters struct {
+	IsGroup     bool              `json:"isGroup"`
+	Bot         *ChannelAccount   `json:"bot,omitempty"`
+	Members     []*ChannelAccount `json:"members,omitempty"`
+	TopicName   string            `json:"topicName,omitempty"`
+	TenantId    string            `json:"tenantId,omitempty"`
+	Activity    *Activity         `json:"activity,omitempty"`
+	ChannelData interface{}       `json:"channelData,omitempty"`
+}
+
+type ConversationResourceResponse struct {
+	Identification
+	ActivityId string `json:"activityId,omitempty"`
+	ServiceUrl string `json:"serviceUrl,omitempty"`
+}
+
+type ConversationMembers struct {
+	Identification
+	Members []*ChannelAccount `json:"members"`
+}
+
+type ConversationsResult struct {
+	ContinuationToken string                 `json:"continuationToken,omitempty"`
+	Conversations     []*ConversationMembers `json:"conversations"`
+}
+
+type PagedMembersResult struct {
+	ContinuationToken string            `json:"continuationToken,omitempty"`
+	Members           []*ChannelAccount `json:"members"`
+}
+
+type Transcript struct {
+	Activities []*Activity `json:"activities"`
+}
+
+type AttachmentData struct {
+	Type            string `json:"type"`
+	Name            string `json:"name,omitempty"`
+	OriginalBase64  []byte `json:"originalBase64,omitempty"`
+	ThumbnailBase64 []byte `json:"thumbnailBase64,omitempty"`
+}
+
+func (b *MSBot) CreateConversation(ctx context.Context, serviceUrl string, parameters *ConversationParameters) (*ConversationResourceResponse, error) {
+	result := &ConversationResourceResponse{}
+	request := gorequest.New().Post(connectorUrl(serviceUrl)).Send(parameters)
+	err := b.connectorCall(ctx, "", request, result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if result.ServiceUrl == "" {
+		result.ServiceUrl = serviceUrl
+	}
+
+	return result, nil
+}
+
+func (b *MSBot) GetConversations(ctx context.Context, serviceUrl string, continuationToken string) (*ConversationsResult, error) {
+	result := &ConversationsResult{}
+	u := connectorUrl(serviceUrl)
+
+	if continuationToken != "" {
+		u += "?continuationToken=" + url.QueryEscape(continuationToken)
+	}
+
+	err := b.connectorCall(ctx, "", gorequest.New().Get(u), result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *MSBot) GetConversationMembers(ctx context.Context, serviceUrl string, conversationId string) ([]*ChannelAccount, error) {
+	var result []*ChannelAccount
+	err := b.connectorCall(ctx, conversationId, gorequest.New().Get(connectorUrl(serviceUrl, conversationId, "members")), &result)
+	return result, err
+}
+
+func (b *MSBot) GetConversationPagedMembers(ctx context.Context, serviceUrl string, conversationId string, pageSize int, continuationToken string) (*PagedMembersResult, error) {
+	result := &PagedMembersResult{}
+	query := url.Values{}
+
+	if pageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(pageSize))
+	}
+
+	if continuationToken != "" {
+		query.Set("continuationToken", continuationToken)
+	}
+
+	u := connectorUrl(serviceUrl, conversationId, "pagedmembers")
+
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	err := b.connectorCall(ctx, conversationId, gorequest.New().Get(u), result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *MSBot) GetActivityMembers(ctx context.Context, serviceUrl string, conversationId string, activityId string) ([]*ChannelAccount, error) {
+	var result []*ChannelAccount
+	u := connectorUrl(serviceUrl, conversationId, "activities", activityId, "members")
+	err := b.connectorCall(ctx, conversationId, gorequest.New().Get(u), &result)
+	return result, err
+}
+
+func (b *MSBot) SendConversationHistory(ctx context.Context, serviceUrl string, conversationId string, transcript *Transcript) (*Identification, error) {
+	result := &Identification{}
+	u := connectorUrl(serviceUrl, conversationId, "activities", "history")
+	err := b.connectorCall(ctx, conversationId, gorequest.New().Post(u).Send(transcript), result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *MSBot) UploadAttachment(ctx context.Context, serviceUrl string, conversationId string, attachment *AttachmentData) (*Identification, error) {
+	result := &Identification{}
+	u := connectorUrl(serviceUrl, conversationId, "attachments")
+	err := b.connectorCall(ctx, conversationId, gorequest.New().Post(u).Send(attachment), result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (b *MSBot) connectorCall(ctx context.Context, conversationId string, request *gorequest.SuperAgent, result interface{}) error {
+	resp, err := b.authenticatedRequest(ctx, conversationId, request, false)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func connectorUrl(serviceUrl string, segments ...string) string {
+	result := strings.TrimRight(serviceUrl, "/") + "/v3/conversations"
+
+	for _, s := range segments {
+		if s != "" {
+			result += "/" + url.PathEscape(s)
+		}
+	}
+
+	return result
+}
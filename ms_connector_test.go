@@ -0,0 +1,238 @@
+package bots_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/msbottest"
+)
+
+func connectorServer(t *testing.T, members int) (*msbottest.Server, *bots.MSBot) {
+	server, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(server.Close)
+
+	for i := 1; i <= members; i++ {
+		id := "user" + strconv.Itoa(i)
+		server.Members = append(server.Members, &bots.ChannelAccount{Identification: bots.Identification{Id: id}, Name: id})
+	}
+
+	bot := bots.NewMSBot(server.Settings())
+	t.Cleanup(func() { bot.Close() })
+	return server, bot
+}
+
+func lastCall(t *testing.T, server *msbottest.Server) *msbottest.ConnectorCall {
+	calls := server.Calls()
+
+	if len(calls) == 0 {
+		t.Fatal("no connector calls")
+	}
+
+	call := calls[len(calls)-1]
+
+	if !strings.HasPrefix(call.Authorization, "Bearer ") {
+		t.Fatalf("call without a bearer token: %+v", call)
+	}
+
+	return call
+}
+
+func TestMSConnectorConversations(t *testing.T) {
+	server, bot := connectorServer(t, 3)
+	ctx := context.Background()
+	created, err := bot.CreateConversation(ctx, server.URL, &bots.ConversationParameters{
+		Bot:      &bots.ChannelAccount{Identification: bots.Identification{Id: "app"}},
+		Members:  server.Members[:1],
+		Activity: &bots.Activity{Type: bots.TypeMessage, Text: "hello"},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(created.Id, "conversation-") || created.ActivityId == "" || created.ServiceUrl != server.URL {
+		t.Fatalf("unexpected conversation %+v", created)
+	}
+
+	call := lastCall(t, server)
+	parameters := &bots.ConversationParameters{}
+
+	if err := json.Unmarshal(call.Body, parameters); err != nil {
+		t.Fatal(err)
+	}
+
+	if call.Method != http.MethodPost || call.ConversationId != "" || len(parameters.Members) != 1 ||
+		parameters.Members[0].Id != "user1" || parameters.Activity.Text != "hello" {
+		t.Fatalf("unexpected create call %+v with %+v", call, parameters)
+	}
+
+	members, err := bot.GetConversationMembers(ctx, server.URL, created.Id)
+
+	if err != nil || len(members) != 3 || members[2].Id != "user3" {
+		t.Fatalf("GetConversationMembers = %+v, %v", members, err)
+	}
+
+	if call := lastCall(t, server); call.Method != http.MethodGet || call.Resource != "members" || call.ConversationId != created.Id {
+		t.Fatalf("unexpected members call %+v", call)
+	}
+
+	members, err = bot.GetActivityMembers(ctx, server.URL, created.Id, created.ActivityId)
+
+	if err != nil || len(members) != 3 {
+		t.Fatalf("GetActivityMembers = %+v, %v", members, err)
+	}
+
+	if call := lastCall(t, server); call.Resource != "members" || call.ActivityId != created.ActivityId {
+		t.Fatalf("unexpected activity members call %+v", call)
+	}
+
+	conversations, err := bot.GetConversations(ctx, server.URL, "")
+
+	if err != nil || len(conversations.Conversations) != 1 || conversations.Conversations[0].Id != created.Id ||
+		len(conversations.Conversations[0].Members) != 3 {
+		t.Fatalf("GetConversations = %+v, %v", conversations, err)
+	}
+}
+
+func TestMSConnectorPagedMembers(t *testing.T) {
+	server, bot := connectorServer(t, 5)
+	var ids []string
+	var pages []int
+	token := ""
+
+	for {
+		page, err := bot.GetConversationPagedMembers(context.Background(), server.URL, "conversation", 2, token)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pages = append(pages, len(page.Members))
+
+		for _, member := range page.Members {
+			ids = append(ids, member.Id)
+		}
+
+		if token = page.ContinuationToken; token == "" {
+			break
+		}
+
+		if len(pages) > 5 {
+			t.Fatalf("paging did not end, pages %v", pages)
+		}
+	}
+
+	if got := strings.Join(ids, ","); got != "user1,user2,user3,user4,user5" {
+		t.Fatalf("members = %s", got)
+	}
+
+	if len(pages) != 3 || pages[0] != 2 || pages[1] != 2 || pages[2] != 1 {
+		t.Fatalf("page sizes = %v, want [2 2 1]", pages)
+	}
+
+	page, err := bot.GetConversationPagedMembers(context.Background(), server.URL, "conversation", 0, "")
+
+	if err != nil || len(page.Members) != 5 || page.ContinuationToken != "" {
+		t.Fatalf("unpaged members = %+v, %v", page, err)
+	}
+}
+
+func TestMSConnectorHistoryAndAttachments(t *testing.T) {
+	server, bot := connectorServer(t, 0)
+	ctx := context.Background()
+	transcript := &bots.Transcript{Activities: []*bots.Activity{
+		server.NewActivity("first"),
+		server.NewActivity("second"),
+	}}
+
+	id, err := bot.SendConversationHistory(ctx, server.URL, "conversation", transcript)
+
+	if err != nil || id.Id == "" {
+		t.Fatalf("SendConversationHistory = %+v, %v", id, err)
+	}
+
+	call := lastCall(t, server)
+	sent := &bots.Transcript{}
+
+	if err := json.Unmarshal(call.Body, sent); err != nil {
+		t.Fatal(err)
+	}
+
+	if call.Method != http.MethodPost || call.Resource != "history" || call.ConversationId != "conversation" ||
+		len(sent.Activities) != 2 || sent.Activities[1].Text != "second" {
+		t.Fatalf("unexpected history call %+v with %+v", call, sent)
+	}
+
+	attachment := &bots.AttachmentData{Type: "image/png", Name: "dot.png", OriginalBase64: []byte{0x89, 'P', 'N', 'G'}}
+	id, err = bot.UploadAttachment(ctx, server.URL, "conversation", attachment)
+
+	if err != nil || id.Id == "" {
+		t.Fatalf("UploadAttachment = %+v, %v", id, err)
+	}
+
+	call = lastCall(t, server)
+	uploaded := &bots.AttachmentData{}
+
+	if err := json.Unmarshal(call.Body, uploaded); err != nil {
+		t.Fatal(err)
+	}
+
+	if call.Method != http.MethodPost || call.Resource != "attachments" || uploaded.Name != "dot.png" ||
+		uploaded.Type != "image/png" || !bytes.Equal(uploaded.OriginalBase64, attachment.OriginalBase64) {
+		t.Fatalf("unexpected attachment call %+v with %+v", call, uploaded)
+	}
+}
+
+func TestMSConnectorEscaping(t *testing.T) {
+	server, bot := connectorServer(t, 1)
+	ids := []string{
+		"19:abc@thread.skype",
+		"a:1;messageid=2",
+		"with space/and slash",
+		"query?and#fragment",
+		"percent%2Fencoded+plus",
+	}
+
+	for _, id := range ids {
+		if _, err := bot.GetActivityMembers(context.Background(), server.URL+"/", id, id); err != nil {
+			t.Fatalf("%q: %v", id, err)
+		}
+
+		if call := lastCall(t, server); call.ConversationId != id || call.ActivityId != id || call.Resource != "members" {
+			t.Fatalf("%q arrived as conversation %q, activity %q, resource %q", id, call.ConversationId, call.ActivityId, call.Resource)
+		}
+	}
+}
+
+func TestMSConnectorRefreshesRevokedToken(t *testing.T) {
+	server, bot := connectorServer(t, 1)
+
+	if _, err := bot.GetConversationMembers(context.Background(), server.URL, "conversation"); err != nil {
+		t.Fatal(err)
+	}
+
+	server.RevokeTokens()
+
+	if _, err := bot.GetConversationMembers(context.Background(), server.URL, "conversation"); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokens := server.TokenRequests(); len(tokens) != 2 {
+		t.Fatalf("got %d token requests, want a refresh after the revoked token", len(tokens))
+	}
+
+	if _, err := bot.GetConversationMembers(context.Background(), server.URL+"/unknown", "conversation"); err == nil {
+		t.Fatal("expected an error for a connector that answers 404")
+	}
+}
@@ -0,0 +1,102 @@
+package bots_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/msbottest"
+)
+
+func TestMSBotWithFakeConnector(t *testing.T) {
+	server, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+	bot := bots.NewMSBot(server.Settings())
+	defer bot.Close()
+	updates, _ := bot.GetUpdatesChannel()
+	activity := server.NewActivity("hi")
+	activity.Conversation.Id = "a:1;messageid=2/x y+z"
+	served := make(chan int, 1)
+
+	go func() {
+		w, err := server.Post(bot, activity)
+
+		if err != nil {
+			served <- 0
+			return
+		}
+
+		served <- w.Code
+	}()
+
+	var incoming *bots.Activity
+
+	select {
+	case incoming = <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no activity delivered")
+	}
+
+	if code := <-served; code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+
+	reply := incoming.Response("hello")
+	id, err := bot.Send(reply)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply.Id = id.Id
+	reply.Text = "updated"
+
+	if _, err = bot.Update(reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bot.Delete(reply); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := server.TokenRequests()
+
+	if len(tokens) != 1 || !tokens[0].Accepted || tokens[0].ContentType != "multipart/form-data" || tokens[0].GrantType != "client_credentials" {
+		t.Fatalf("unexpected token requests %+v", tokens)
+	}
+
+	calls := server.Calls()
+
+	if len(calls) != 3 {
+		t.Fatalf("got %d connector calls, want 3", len(calls))
+	}
+
+	tests := []struct {
+		method     string
+		activityId string
+		text       string
+	}{
+		{http.MethodPost, activity.Id, "hello"},
+		{http.MethodPut, id.Id, "updated"},
+		{http.MethodDelete, id.Id, ""},
+	}
+
+	for i, tt := range tests {
+		call := calls[i]
+
+		if call.Method != tt.method || call.ConversationId != activity.Conversation.Id || call.ActivityId != tt.activityId {
+			t.Fatalf("call %d = %s %q %q, want %s %q %q", i, call.Method, call.ConversationId, call.ActivityId,
+				tt.method, activity.Conversation.Id, tt.activityId)
+		}
+
+		if tt.text != "" && (call.Activity == nil || call.Activity.Text != tt.text) {
+			t.Fatalf("call %d sent %+v, want text %q", i, call.Activity, tt.text)
+		}
+	}
+}
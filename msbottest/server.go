@@ -0,0 +1,488 @@
+package msbottest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/nickalie/bots"
+)
+
+const (
+	Issuer        = "https://api.botframework.com"
+	TokenLifetime = time.Hour
+
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+type ConnectorCall struct {
+	Method         string
+	Resource       string
+	ConversationId string
+	ActivityId     string
+	Activity       *bots.Activity
+	Body           []byte
+	Authorization  string
+}
+
+type TokenRequest struct {
+	ContentType   string
+	GrantType     string
+	ClientId      string
+	Scope         string
+	AssertionType string
+	Assertion     string
+	Accepted      bool
+}
+
+type Server struct {
+	*httptest.Server
+	AppId        string
+	AppPassword  string
+	Endorsements []string
+	Members      []*bots.ChannelAccount
+	Certificate  *x509.Certificate
+	key          *rsa.PrivateKey
+	kid          string
+	mu           sync.Mutex
+	tokens       map[string]time.Time
+	calls        []*ConnectorCall
+	tokenCalls   []*TokenRequest
+	lastId       int64
+}
+
+func NewServer(appId, appPassword string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		AppId:       appId,
+		AppPassword: appPassword,
+		Endorsements: []string{bots.ChannelWebChat, bots.ChannelSkype, bots.ChannelTelegram, bots.ChannelKik,
+			bots.ChannelLine, bots.ChannelFacebook, bots.ChannelSlack, "emulator", "msteams"},
+		key:    key,
+		kid:    randomString(8),
+		tokens: make(map[string]time.Time),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", s.handleToken)
+	mux.HandleFunc("/.well-known/openidconfiguration", s.handleOpenIdConfig)
+	mux.HandleFunc("/keys", s.handleKeys)
+	mux.HandleFunc("/", s.handleConnector)
+	s.Server = httptest.NewServer(mux)
+	return s, nil
+}
+
+func (s *Server) Endpoint() *bots.MSBotEndpoint {
+	return &bots.MSBotEndpoint{
+		RefreshEndpoint:            s.URL + "/oauth2/token",
+		RefreshScope:               s.URL + "/.default",
+		BotConnectorOpenIdMetadata: s.URL + "/.well-known/openidconfiguration",
+		BotConnectorIssuers:        []string{Issuer},
+		BotConnectorAudience:       s.AppId,
+		EmulatorOpenIdMetadata:     s.URL + "/.well-known/openidconfiguration",
+		EmulatorIssuers:            []string{Issuer},
+		EmulatorAudience:           s.AppId,
+	}
+}
+
+func (s *Server) Settings() *bots.MSBotSettings {
+	return &bots.MSBotSettings{
+		AppId:            s.AppId,
+		AppPassword:      s.AppPassword,
+		Endpoint:         s.Endpoint(),
+		ValidateRequests: true,
+		Channels:         []string{bots.ChannelWebChat},
+	}
+}
+
+func (s *Server) IssueCertificate() (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: s.AppId},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	s.Certificate = certificate
+	s.mu.Unlock()
+	return certificate, key, nil
+}
+
+func (s *Server) NewActivity(text string) *bots.Activity {
+	activity := &bots.Activity{}
+	activity.Id = s.nextId()
+	activity.Type = bots.TypeMessage
+	activity.Text = text
+	activity.ChannelId = bots.ChannelWebChat
+	activity.ServiceUrl = s.URL
+	activity.From = &bots.ChannelAccount{Identification: bots.Identification{Id: "user"}, Name: "user"}
+	activity.Recipient = &bots.ChannelAccount{Identification: bots.Identification{Id: s.AppId}, Name: "bot"}
+	activity.Conversation = &bots.ConversationAccount{ChannelAccount: bots.ChannelAccount{
+		Identification: bots.Identification{Id: "conversation"},
+	}}
+	return activity
+}
+
+func (s *Server) SignActivity(activity *bots.Activity) (string, error) {
+	return s.Sign(jwt.MapClaims{
+		"iss":        Issuer,
+		"aud":        s.AppId,
+		"serviceurl": activity.ServiceUrl,
+		"nbf":        time.Now().Add(-time.Minute).Unix(),
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(TokenLifetime).Unix(),
+	})
+}
+
+func (s *Server) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	return token.SignedString(s.key)
+}
+
+func (s *Server) Request(activity *bots.Activity) (*http.Request, error) {
+	token, err := s.SignActivity(activity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(activity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r, nil
+}
+
+func (s *Server) Post(handler http.Handler, activity *bots.Activity) (*httptest.ResponseRecorder, error) {
+	r, err := s.Request(activity)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, nil
+}
+
+func (s *Server) Calls() []*ConnectorCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*ConnectorCall(nil), s.calls...)
+}
+
+func (s *Server) TokenRequests() []*TokenRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*TokenRequest(nil), s.tokenCalls...)
+}
+
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]time.Time)
+}
+
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+	s.tokenCalls = nil
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(1 << 20); err == http.ErrNotMultipart {
+		r.ParseForm()
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	call := &TokenRequest{
+		ContentType:   contentType,
+		GrantType:     r.FormValue("grant_type"),
+		ClientId:      r.FormValue("client_id"),
+		Scope:         r.FormValue("scope"),
+		AssertionType: r.FormValue("client_assertion_type"),
+		Assertion:     r.FormValue("client_assertion"),
+	}
+
+	call.Accepted = call.GrantType == "client_credentials" && call.ClientId == s.AppId && s.validClient(r)
+	s.mu.Lock()
+	s.tokenCalls = append(s.tokenCalls, call)
+	s.mu.Unlock()
+
+	if !call.Accepted {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	token := randomString(32)
+	s.mu.Lock()
+	s.tokens[token] = time.Now().Add(TokenLifetime)
+	s.mu.Unlock()
+
+	writeJSON(w, map[string]interface{}{
+		"token_type":   "Bearer",
+		"expires_in":   int64(TokenLifetime / time.Second),
+		"access_token": token,
+	})
+}
+
+func (s *Server) validClient(r *http.Request) bool {
+	if r.FormValue("client_assertion_type") != clientAssertionType {
+		return s.AppPassword != "" && r.FormValue("client_secret") == s.AppPassword
+	}
+
+	s.mu.Lock()
+	certificate := s.Certificate
+	s.mu.Unlock()
+
+	if certificate == nil {
+		return false
+	}
+
+	token, err := jwt.Parse(r.FormValue("client_assertion"), func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		thumbprint := sha1.Sum(certificate.Raw)
+
+		if token.Header["x5t"] != base64.RawURLEncoding.EncodeToString(thumbprint[:]) {
+			return nil, errors.New("unknown certificate")
+		}
+
+		return certificate.PublicKey, nil
+	})
+
+	if err != nil || !token.Valid {
+		return false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	return ok && claims["iss"] == s.AppId && claims["sub"] == s.AppId && claims.VerifyAudience(s.URL+"/oauth2/token", true)
+}
+
+func (s *Server) handleOpenIdConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"issuer":                                Issuer,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"jwks_uri":                              s.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"private_key_jwt"},
+	})
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"keys": []map[string]interface{}{{
+			"kty":          "RSA",
+			"use":          "sig",
+			"kid":          s.kid,
+			"n":            base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":            base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			"endorsements": s.Endorsements,
+		}},
+	})
+}
+
+func (s *Server) handleConnector(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+
+	for i, p := range parts {
+		if v, err := url.PathUnescape(p); err == nil {
+			parts[i] = v
+		}
+	}
+
+	if len(parts) < 2 || parts[0] != "v3" || parts[1] != "conversations" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	authorization := r.Header.Get("Authorization")
+
+	if !s.validToken(strings.TrimPrefix(authorization, "Bearer ")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	call := &ConnectorCall{
+		Method:        r.Method,
+		Resource:      "conversations",
+		Body:          body,
+		Authorization: authorization,
+	}
+
+	if len(parts) > 2 {
+		call.ConversationId = parts[2]
+	}
+
+	if len(parts) > 3 {
+		call.Resource = parts[3]
+	}
+
+	if len(parts) > 4 {
+		call.ActivityId = parts[4]
+	}
+
+	if call.Resource == "activities" && call.ActivityId == "history" {
+		call.Resource = "history"
+		call.ActivityId = ""
+	} else if call.Resource == "activities" && len(parts) > 5 {
+		call.Resource = parts[5]
+	}
+
+	if call.Resource == "activities" && (r.Method == http.MethodPost || r.Method == http.MethodPut) {
+		call.Activity = &bots.Activity{}
+
+		if err := json.Unmarshal(body, call.Activity); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	members := append([]*bots.ChannelAccount(nil), s.Members...)
+	s.mu.Unlock()
+
+	switch {
+	case call.Resource == "conversations" && r.Method == http.MethodPost:
+		writeJSON(w, map[string]string{"id": "conversation-" + s.nextId(), "activityId": s.nextId(), "serviceUrl": s.URL})
+	case call.Resource == "conversations" && r.Method == http.MethodGet:
+		writeJSON(w, map[string]interface{}{"conversations": s.conversations(members)})
+	case call.Resource == "members" && r.Method == http.MethodGet:
+		writeJSON(w, members)
+	case call.Resource == "pagedmembers" && r.Method == http.MethodGet:
+		writeJSON(w, pagedMembers(members, r.URL.Query()))
+	case r.Method == http.MethodPost:
+		writeJSON(w, map[string]string{"id": s.nextId()})
+	case r.Method == http.MethodPut:
+		writeJSON(w, map[string]string{"id": call.ActivityId})
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) conversations(members []*bots.ChannelAccount) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []map[string]interface{}
+	seen := make(map[string]bool)
+
+	for _, call := range s.calls {
+		if call.ConversationId != "" && !seen[call.ConversationId] {
+			seen[call.ConversationId] = true
+			result = append(result, map[string]interface{}{"id": call.ConversationId, "members": members})
+		}
+	}
+
+	return result
+}
+
+func pagedMembers(members []*bots.ChannelAccount, query url.Values) map[string]interface{} {
+	start, _ := strconv.Atoi(query.Get("continuationToken"))
+	size, _ := strconv.Atoi(query.Get("pageSize"))
+
+	if start > len(members) {
+		start = len(members)
+	}
+
+	if size <= 0 || start+size > len(members) {
+		size = len(members) - start
+	}
+
+	result := map[string]interface{}{"members": members[start : start+size]}
+
+	if start+size < len(members) {
+		result["continuationToken"] = strconv.Itoa(start + size)
+	}
+
+	return result
+}
+
+func (s *Server) validToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.tokens[token]
+	return ok && time.Now().Before(expires)
+}
+
+func (s *Server) nextId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastId++
+	return strconv.FormatInt(s.lastId, 10)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.New("msbottest: unable to generate random string: " + err.Error()))
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -1,21 +1,52 @@
 package bots
 
 import (
+	"context"
 	"errors"
+	"github.com/nickalie/bots/utils"
 	"github.com/thoas/go-funk"
 	"net/http"
+	"sync"
 )
 
 type MultiBot struct {
 	bots    []Bot
 	updates chan *Activity
+	mu      sync.Mutex
+	started bool
+	closing bool
+	fanIn   sync.WaitGroup
+	done    chan struct{}
+	abort   chan struct{}
+	mux     *http.ServeMux
 }
 
 func NewMultiBot(bots ...Bot) *MultiBot {
-	return &MultiBot{bots: bots, updates: make(chan *Activity)}
+	return &MultiBot{
+		bots:    bots,
+		updates: make(chan *Activity),
+		done:    make(chan struct{}),
+		abort:   make(chan struct{}),
+		mux:     http.NewServeMux(),
+	}
+}
+
+func (b *MultiBot) Handle(pattern string, bot Bot) {
+	b.mux.Handle(pattern, bot)
 }
 
 func (b *MultiBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closing {
+		return nil, ErrBotClosed
+	}
+
+	if b.started {
+		return b.updates, nil
+	}
+
 	for _, bot := range b.bots {
 		updates, err := bot.GetUpdatesChannel()
 
@@ -23,12 +54,55 @@ func (b *MultiBot) GetUpdatesChannel() (<-chan *Activity, error) {
 			return nil, err
 		}
 
+		b.fanIn.Add(1)
 		go b.startUpdates(updates)
 	}
 
+	b.started = true
 	return b.updates, nil
 }
 
+func (b *MultiBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	if b.isClosing() {
+		return nil, ErrBotClosed
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	result := make(chan *Activity)
+	wg := sync.WaitGroup{}
+
+	for _, bot := range b.bots {
+		updates, err := contextBot(bot).GetUpdatesChannelContext(ctx)
+
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		wg.Add(1)
+
+		go func(updates <-chan *Activity) {
+			defer wg.Done()
+
+			for m := range updates {
+				select {
+				case result <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(updates)
+	}
+
+	go func() {
+		wg.Wait()
+		cancel()
+		close(result)
+	}()
+
+	return result, nil
+}
+
 func (b *MultiBot) GetPlatforms() (result []string) {
 	for _, bot := range b.bots {
 		result = append(result, bot.GetChannels()...)
@@ -38,35 +112,51 @@ func (b *MultiBot) GetPlatforms() (result []string) {
 }
 
 func (b *MultiBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *MultiBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
 	if bot := b.findBotByChannel(activity.ChannelId); bot != nil {
-		return bot.Send(activity)
+		return contextBot(bot).SendContext(ctx, activity)
 	}
 
 	return nil, errors.New("MultiBot.Send: Unknown platform: " + activity.ChannelId)
 }
 
 func (b *MultiBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *MultiBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
 	if bot := b.findBotByChannel(activity.ChannelId); bot != nil {
-		return bot.Update(activity)
+		return contextBot(bot).UpdateContext(ctx, activity)
 	}
 
-	return nil, errors.New("MultiBot.Send: Unknown platform: " + activity.ChannelId)
+	return nil, errors.New("MultiBot.Update: Unknown platform: " + activity.ChannelId)
 }
 
 func (b *MultiBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *MultiBot) DeleteContext(ctx context.Context, activity *Activity) error {
 	if bot := b.findBotByChannel(activity.ChannelId); bot != nil {
-		return bot.Delete(activity)
+		return contextBot(bot).DeleteContext(ctx, activity)
 	}
 
-	return errors.New("MultiBot.Send: Unknown platform: " + activity.ChannelId)
+	return errors.New("MultiBot.Delete: Unknown platform: " + activity.ChannelId)
 }
 
 func (b *MultiBot) GetFile(file *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), file, activity)
+}
+
+func (b *MultiBot) GetFileContext(ctx context.Context, file *Attachment, activity *Activity) (*http.Response, error) {
 	if bot := b.findBotByChannel(activity.ChannelId); bot != nil {
-		return bot.GetFile(file, activity)
+		return contextBot(bot).GetFileContext(ctx, file, activity)
 	}
 
-	return nil, errors.New("MultiBot.Send: Unknown platform: " + activity.ChannelId)
+	return nil, errors.New("MultiBot.GetFile: Unknown platform: " + activity.ChannelId)
 }
 
 func (b *MultiBot) GetChannels() (result []string) {
@@ -77,10 +167,77 @@ func (b *MultiBot) GetChannels() (result []string) {
 	return
 }
 
+func (b *MultiBot) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+
+	if b.closing {
+		b.mu.Unlock()
+		return ErrBotClosed
+	}
+
+	b.closing = true
+	b.mu.Unlock()
+
+	finished := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(b.abort)
+		case <-finished:
+		}
+	}()
+
+	var errs []error
+
+	for _, bot := range b.bots {
+		if s, ok := bot.(Shutdowner); ok {
+			if err := s.Shutdown(ctx); err != nil && err != ErrBotClosed && err != ctx.Err() {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	close(b.done)
+	b.fanIn.Wait()
+	close(finished)
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	close(b.updates)
+
+	if len(errs) > 0 {
+		return utils.ErrorFromArray(errs)
+	}
+
+	return nil
+}
+
+func (b *MultiBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
 func (b *MultiBot) startUpdates(updates <-chan *Activity) {
+	defer b.fanIn.Done()
+
 	for {
-		m := <-updates
-		b.updates <- m
+		select {
+		case m, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			select {
+			case b.updates <- m:
+			case <-b.abort:
+			}
+		case <-b.done:
+			return
+		}
 	}
 }
 
@@ -95,5 +252,16 @@ func (b *MultiBot) findBotByChannel(channel string) Bot {
 }
 
 func (b *MultiBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if b.isClosing() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	b.mux.ServeHTTP(w, r)
+}
 
+func (b *MultiBot) isClosing() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closing
 }
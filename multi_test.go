@@ -0,0 +1,230 @@
+package bots_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/bottest"
+)
+
+func fakeBot(channel string) *bottest.Bot {
+	bot := bottest.NewBot()
+	bot.Channel = channel
+	return bot
+}
+
+// routedBot records the webhook paths it serves.
+type routedBot struct {
+	*bottest.Bot
+	mu    sync.Mutex
+	paths []string
+}
+
+func (b *routedBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.paths = append(b.paths, r.URL.Path)
+	b.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (b *routedBot) served() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.paths
+}
+
+func TestMultiBotFanIn(t *testing.T) {
+	a, b := fakeBot("a"), fakeBot("b")
+	bot := bots.NewMultiBot(a, b)
+	defer bot.Close()
+	updates, err := bot.GetUpdatesChannel()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := bot.GetUpdatesChannel(); again != updates {
+		t.Fatal("GetUpdatesChannel returned a second channel")
+	}
+
+	errs := make(chan error, 2)
+
+	for _, fake := range []*bottest.Bot{a, b} {
+		go func(fake *bottest.Bot) {
+			_, err := fake.Say("from " + fake.Channel)
+			errs <- err
+		}(fake)
+	}
+
+	var texts []string
+
+	for i := 0; i < 2; i++ {
+		select {
+		case activity := <-updates:
+			if activity.Text != "from "+activity.ChannelId {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+
+			texts = append(texts, activity.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no activity delivered")
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sort.Strings(texts)
+
+	if texts[0] != "from a" || texts[1] != "from b" {
+		t.Fatalf("got %v", texts)
+	}
+
+	if _, err := bot.Send(b.NewActivity(bots.TypeMessage, "reply")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.Sent()) != 0 || len(b.Sent()) != 1 {
+		t.Fatalf("send was routed to a: %d, b: %d", len(a.Sent()), len(b.Sent()))
+	}
+
+	if _, err := bot.Send(fakeBot("c").NewActivity(bots.TypeMessage, "reply")); err == nil {
+		t.Fatal("expected an error for an unknown platform")
+	}
+}
+
+func TestMultiBotShutdownDrains(t *testing.T) {
+	fake := fakeBot("a")
+	bot := bots.NewMultiBot(fake)
+	updates, err := bot.GetUpdatesChannel()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fan-in goroutine holds the activity until the consumer reads it.
+	if _, err := fake.Say("in flight"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+
+	go func() {
+		result <- bot.Shutdown(ctx)
+	}()
+
+	select {
+	case activity := <-updates:
+		if activity.Text != "in flight" {
+			t.Fatalf("unexpected activity %+v", activity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight activity was not delivered")
+	}
+
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := <-updates; ok {
+		t.Fatal("updates channel is open after Shutdown")
+	}
+
+	if _, err := bot.GetUpdatesChannel(); err != bots.ErrBotClosed {
+		t.Fatalf("GetUpdatesChannel = %v, want %v", err, bots.ErrBotClosed)
+	}
+
+	if err := bot.Shutdown(context.Background()); err != bots.ErrBotClosed {
+		t.Fatalf("second Shutdown = %v, want %v", err, bots.ErrBotClosed)
+	}
+
+	if _, err := fake.Say("late"); err != bots.ErrBotClosed {
+		t.Fatalf("Say after Shutdown = %v, want %v", err, bots.ErrBotClosed)
+	}
+}
+
+func TestMultiBotShutdownDropsUnreadUpdates(t *testing.T) {
+	fake := fakeBot("a")
+	bot := bots.NewMultiBot(fake)
+	updates, err := bot.GetUpdatesChannel()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fake.Say("unread"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+
+	if err := bot.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Shutdown took %v past its deadline", elapsed)
+	}
+
+	if activity, ok := <-updates; ok {
+		t.Fatalf("unread activity delivered after Shutdown: %+v", activity)
+	}
+}
+
+func TestMultiBotWebhookRouting(t *testing.T) {
+	a := &routedBot{Bot: fakeBot("a")}
+	b := &routedBot{Bot: fakeBot("b")}
+	bot := bots.NewMultiBot(a, b)
+	bot.Handle("/a", a)
+	bot.Handle("/b/", b)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/a", http.StatusAccepted},
+		{"/b/hook", http.StatusAccepted},
+		{"/c", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		bot.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, nil))
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: status = %d, want %d", tt.path, w.Code, tt.status)
+		}
+	}
+
+	if paths := a.served(); len(paths) != 1 || paths[0] != "/a" {
+		t.Fatalf("a served %v", paths)
+	}
+
+	if paths := b.served(); len(paths) != 1 || paths[0] != "/b/hook" {
+		t.Fatalf("b served %v", paths)
+	}
+
+	if err := bot.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	bot.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/a", nil))
+
+	if w.Code != http.StatusServiceUnavailable || len(a.served()) != 1 {
+		t.Fatalf("status after Close = %d, served %v", w.Code, a.served())
+	}
+}
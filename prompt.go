@@ -0,0 +1,204 @@
+package bots
+
+import (
+	"strconv"
+	"strings"
+)
+
+type PromptOptions struct {
+	Prompt      string   `json:"prompt,omitempty"`
+	RetryPrompt string   `json:"retryPrompt,omitempty"`
+	Choices     []string `json:"choices,omitempty"`
+}
+
+type PromptValidator func(t *Turn, value interface{}) bool
+
+type Prompt struct {
+	Validator  PromptValidator
+	MaxRetries int
+	id         string
+	recognize  func(a *Activity, options *PromptOptions) (interface{}, bool)
+	choices    func(options *PromptOptions) []string
+}
+
+func NewTextPrompt(id string) *Prompt {
+	return &Prompt{id: id, recognize: recognizeText}
+}
+
+func NewNumberPrompt(id string) *Prompt {
+	return &Prompt{id: id, recognize: recognizeNumber}
+}
+
+func NewChoicePrompt(id string) *Prompt {
+	return &Prompt{id: id, recognize: recognizeChoice, choices: func(options *PromptOptions) []string {
+		return options.Choices
+	}}
+}
+
+func NewConfirmPrompt(id string) *Prompt {
+	return &Prompt{id: id, recognize: recognizeConfirm, choices: func(options *PromptOptions) []string {
+		if len(options.Choices) == 2 {
+			return options.Choices
+		}
+
+		return []string{"Yes", "No"}
+	}}
+}
+
+func NewAttachmentPrompt(id string) *Prompt {
+	return &Prompt{id: id, recognize: recognizeAttachment}
+}
+
+func (p *Prompt) Id() string {
+	return p.id
+}
+
+func (p *Prompt) Begin(dc *DialogContext, options interface{}) (*DialogTurnResult, error) {
+	promptOptions := &PromptOptions{}
+
+	if options != nil {
+		if err := decodeState(options, promptOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	state := dc.ActiveDialog().State
+	state["options"] = promptOptions
+	state["attempts"] = 0
+
+	if err := p.send(dc, promptOptions, promptOptions.Prompt); err != nil {
+		return nil, err
+	}
+
+	return dc.Wait()
+}
+
+func (p *Prompt) Continue(dc *DialogContext) (*DialogTurnResult, error) {
+	if dc.Turn.Activity.Type != TypeMessage {
+		return &DialogTurnResult{Status: DialogWaiting}, nil
+	}
+
+	state := dc.ActiveDialog().State
+	options := &PromptOptions{}
+
+	if err := decodeState(state["options"], options); err != nil {
+		return nil, err
+	}
+
+	value, ok := p.recognize(dc.Turn.Activity, options)
+
+	if ok && (p.Validator == nil || p.Validator(dc.Turn, value)) {
+		return dc.End(value)
+	}
+
+	attempts := stateInt(state, "attempts") + 1
+	state["attempts"] = attempts
+
+	if p.MaxRetries > 0 && attempts > p.MaxRetries {
+		return dc.End(nil)
+	}
+
+	retry := options.RetryPrompt
+
+	if retry == "" {
+		retry = options.Prompt
+	}
+
+	if err := p.send(dc, options, retry); err != nil {
+		return nil, err
+	}
+
+	return dc.Wait()
+}
+
+func (p *Prompt) Resume(dc *DialogContext, result interface{}) (*DialogTurnResult, error) {
+	options := &PromptOptions{}
+
+	if err := decodeState(dc.ActiveDialog().State["options"], options); err != nil {
+		return nil, err
+	}
+
+	if err := p.send(dc, options, options.Prompt); err != nil {
+		return nil, err
+	}
+
+	return dc.Wait()
+}
+
+func (p *Prompt) send(dc *DialogContext, options *PromptOptions, text string) error {
+	if text == "" {
+		return nil
+	}
+
+	activity := dc.Turn.Activity.Response(text)
+
+	if p.choices != nil {
+		if choices := p.choices(options); len(choices) > 0 {
+			activity.SuggestedActions = &SuggestedActions{}
+
+			for _, choice := range choices {
+				activity.SuggestedActions.Actions = append(activity.SuggestedActions.Actions, &CardAction{
+					Type:  TypeImBack,
+					Title: choice,
+					Value: choice,
+				})
+			}
+		}
+	}
+
+	_, err := dc.Turn.Send(activity)
+	return err
+}
+
+func recognizeText(a *Activity, options *PromptOptions) (interface{}, bool) {
+	text := strings.TrimSpace(a.Text)
+	return text, text != ""
+}
+
+func recognizeNumber(a *Activity, options *PromptOptions) (interface{}, bool) {
+	value, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(a.Text), ",", ".", 1), 64)
+	return value, err == nil
+}
+
+func recognizeChoice(a *Activity, options *PromptOptions) (interface{}, bool) {
+	text := strings.TrimSpace(a.Text)
+
+	for _, choice := range options.Choices {
+		if strings.EqualFold(choice, text) {
+			return choice, true
+		}
+	}
+
+	if i, err := strconv.Atoi(text); err == nil && i > 0 && i <= len(options.Choices) {
+		return options.Choices[i-1], true
+	}
+
+	return nil, false
+}
+
+func recognizeConfirm(a *Activity, options *PromptOptions) (interface{}, bool) {
+	text := strings.ToLower(strings.TrimSpace(a.Text))
+
+	if len(options.Choices) == 2 {
+		if strings.EqualFold(options.Choices[0], text) {
+			return true, true
+		}
+
+		if strings.EqualFold(options.Choices[1], text) {
+			return false, true
+		}
+	}
+
+	switch text {
+	case "yes", "y", "yep", "ok", "sure", "true", "1":
+		return true, true
+	case "no", "n", "nope", "false", "0":
+		return false, true
+	}
+
+	return nil, false
+}
+
+func recognizeAttachment(a *Activity, options *PromptOptions) (interface{}, bool) {
+	return a.Attachments, len(a.Attachments) > 0
+}
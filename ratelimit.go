@@ -0,0 +1,148 @@
+package bots
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const maxIdleBuckets = 1024
+
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit *RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucket{rate: limit.PerSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+func (b *tokenBucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+time.Since(b.last).Seconds()*b.rate >= b.burst
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	delay := b.reserve()
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+type rateLimiter struct {
+	global       *tokenBucket
+	conversation *RateLimit
+	mu           sync.Mutex
+	buckets      map[string]*tokenBucket
+}
+
+func newRateLimiter(global *RateLimit, conversation *RateLimit) *rateLimiter {
+	result := &rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+	if global != nil && global.PerSecond > 0 {
+		result.global = newTokenBucket(global)
+	}
+
+	if conversation != nil && conversation.PerSecond > 0 {
+		result.conversation = conversation
+	}
+
+	return result
+}
+
+func (l *rateLimiter) wait(ctx context.Context, conversationId string) error {
+	bucket := l.bucket(conversationId)
+
+	if bucket != nil {
+		if err := bucket.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if l.global == nil {
+		return nil
+	}
+
+	err := l.global.wait(ctx)
+
+	if err != nil && bucket != nil {
+		bucket.cancel()
+	}
+
+	return err
+}
+
+func (l *rateLimiter) bucket(conversationId string) *tokenBucket {
+	if l.conversation == nil || conversationId == "" {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[conversationId]
+
+	if ok {
+		return bucket
+	}
+
+	if len(l.buckets) >= maxIdleBuckets {
+		for k, v := range l.buckets {
+			if v.full() {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	bucket = newTokenBucket(l.conversation)
+	l.buckets[conversationId] = bucket
+	return bucket
+}
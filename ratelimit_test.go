@@ -0,0 +1,135 @@
+package bots
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	bucket := newTokenBucket(&RateLimit{PerSecond: 10, Burst: 2})
+	want := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+
+	for i, w := range want {
+		d := bucket.reserve()
+
+		if d < w-10*time.Millisecond || d > w {
+			t.Fatalf("reservation %d waits %v, want about %v", i, d, w)
+		}
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	bucket := newTokenBucket(&RateLimit{PerSecond: 100, Burst: 1})
+	bucket.reserve()
+
+	if bucket.full() {
+		t.Fatal("bucket is full right after a reservation")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if !bucket.full() {
+		t.Fatal("bucket did not refill")
+	}
+
+	if d := bucket.reserve(); d != 0 {
+		t.Fatalf("refilled bucket waits %v", d)
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	bucket := newTokenBucket(&RateLimit{PerSecond: 20, Burst: 1})
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("three waits at 20/s took %v, want at least 100ms", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := bucket.wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if tokens := bucketTokens(bucket); tokens < -0.5 || tokens > 0.5 {
+		t.Fatalf("tokens after cancelled wait = %v, want the reservation returned", tokens)
+	}
+}
+
+func TestRateLimiterReturnsConversationTokenOnCancel(t *testing.T) {
+	limiter := newRateLimiter(&RateLimit{PerSecond: 1, Burst: 1}, &RateLimit{PerSecond: 1, Burst: 2})
+
+	if err := limiter.wait(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.wait(ctx, "b"); err != context.DeadlineExceeded {
+		t.Fatalf("wait = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if !limiter.bucket("b").full() {
+		t.Fatalf("conversation bucket kept the token, tokens = %v", bucketTokens(limiter.bucket("b")))
+	}
+}
+
+func TestRateLimiterPerConversation(t *testing.T) {
+	limiter := newRateLimiter(nil, &RateLimit{PerSecond: 1, Burst: 1})
+	ctx := context.Background()
+
+	if err := limiter.wait(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := limiter.bucket("a").reserve(); d == 0 {
+		t.Fatal("conversation a was not limited")
+	}
+
+	if err := limiter.wait(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if limiter.bucket("") != nil {
+		t.Fatal("requests without a conversation were limited")
+	}
+
+	if newRateLimiter(nil, nil).bucket("a") != nil {
+		t.Fatal("a limiter without a conversation limit created a bucket")
+	}
+}
+
+func TestRateLimiterEvictsIdleBuckets(t *testing.T) {
+	limiter := newRateLimiter(nil, &RateLimit{PerSecond: 1, Burst: 1})
+
+	for i := 0; i < maxIdleBuckets; i++ {
+		limiter.bucket(strconv.Itoa(i))
+	}
+
+	limiter.bucket("0").reserve()
+	limiter.bucket("new")
+
+	if len(limiter.buckets) != 2 {
+		t.Fatalf("buckets = %d, want the busy one and the new one", len(limiter.buckets))
+	}
+
+	if _, ok := limiter.buckets["0"]; !ok {
+		t.Fatal("a busy bucket was evicted")
+	}
+}
+
+func bucketTokens(b *tokenBucket) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
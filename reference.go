@@ -0,0 +1,122 @@
+package bots
+
+import (
+	"context"
+	"errors"
+)
+
+const ContinueConversationEvent = "ContinueConversation"
+
+type ConversationReference struct {
+	ActivityId   string               `json:"activityId,omitempty"`
+	User         *ChannelAccount      `json:"user,omitempty"`
+	Bot          *ChannelAccount      `json:"bot,omitempty"`
+	Conversation *ConversationAccount `json:"conversation,omitempty"`
+	ChannelId    string               `json:"channelId"`
+	ServiceUrl   string               `json:"serviceUrl,omitempty"`
+}
+
+func (a *Activity) GetConversationReference() *ConversationReference {
+	return &ConversationReference{
+		ActivityId:   a.Id,
+		User:         a.From,
+		Bot:          a.Recipient,
+		Conversation: a.Conversation,
+		ChannelId:    a.ChannelId,
+		ServiceUrl:   a.ServiceUrl,
+	}
+}
+
+func (a *Activity) ApplyConversationReference(reference *ConversationReference) *Activity {
+	a.ChannelId = reference.ChannelId
+	a.ServiceUrl = reference.ServiceUrl
+	a.Conversation = reference.Conversation
+	a.From = reference.Bot
+	a.Recipient = reference.User
+
+	if a.Type == "" {
+		a.Type = TypeMessage
+	}
+
+	return a
+}
+
+func (r *ConversationReference) NewActivity(text string) *Activity {
+	result := &Activity{Text: text}
+	return result.ApplyConversationReference(r)
+}
+
+// recipientId falls back to the conversation id, which is the user id on
+// channels with one-to-one conversations only.
+func (r *ConversationReference) recipientId() string {
+	if r.User != nil && r.User.Id != "" {
+		return r.User.Id
+	}
+
+	if r.Conversation != nil {
+		return r.Conversation.Id
+	}
+
+	return ""
+}
+
+func (r *ConversationReference) continuationActivity() *Activity {
+	result := &Activity{}
+	result.Type = TypeEvent
+	result.Name = ContinueConversationEvent
+	result.ChannelId = r.ChannelId
+	result.ServiceUrl = r.ServiceUrl
+	result.Conversation = r.Conversation
+	result.From = r.User
+	result.Recipient = r.Bot
+	return result
+}
+
+func SendProactive(ctx context.Context, bot Bot, reference *ConversationReference, activity *Activity) (*Identification, error) {
+	if err := validReference(reference); err != nil {
+		return nil, err
+	}
+
+	return contextBot(bot).SendContext(ctx, activity.ApplyConversationReference(reference))
+}
+
+func ContinueConversation(ctx context.Context, bot Bot, reference *ConversationReference, handler HandlerFunc) error {
+	if err := validReference(reference); err != nil {
+		return err
+	}
+
+	handler(&Turn{Bot: bot, Activity: reference.continuationActivity(), ctx: ctx})
+	return nil
+}
+
+func (b *MultiBot) SendProactive(ctx context.Context, reference *ConversationReference, activity *Activity) (*Identification, error) {
+	return SendProactive(ctx, b, reference, activity)
+}
+
+func (b *MultiBot) ContinueConversation(ctx context.Context, reference *ConversationReference, handler HandlerFunc) error {
+	if err := validReference(reference); err != nil {
+		return err
+	}
+
+	if b.findBotByChannel(reference.ChannelId) == nil {
+		return errors.New("MultiBot.ContinueConversation: Unknown platform: " + reference.ChannelId)
+	}
+
+	return ContinueConversation(ctx, b, reference, handler)
+}
+
+func validReference(reference *ConversationReference) error {
+	if reference == nil {
+		return errors.New("conversation reference is nil")
+	}
+
+	if reference.ChannelId == "" {
+		return errors.New("conversation reference has no channel")
+	}
+
+	if reference.User == nil && (reference.Conversation == nil || reference.Conversation.Id == "") {
+		return errors.New("conversation reference has no user or conversation")
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package bots_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/msbottest"
+	"github.com/nickalie/bots/vibertest"
+)
+
+func TestSendProactiveViber(t *testing.T) {
+	server := vibertest.NewServer("token")
+	defer server.Close()
+	bot, err := bots.NewViberBot(server.Config("https://example.com/viber"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		reference *bots.ConversationReference
+		receiver  string
+	}{
+		{name: "nil reference"},
+		{name: "no channel", reference: &bots.ConversationReference{User: account("U1")}},
+		{name: "no user or conversation", reference: &bots.ConversationReference{ChannelId: bots.ChannelViber}},
+		{name: "empty conversation", reference: &bots.ConversationReference{ChannelId: bots.ChannelViber, Conversation: &bots.ConversationAccount{}}},
+		{name: "user", reference: &bots.ConversationReference{ChannelId: bots.ChannelViber, User: account("U1")}, receiver: "U1"},
+		{
+			name:      "conversation without user",
+			reference: &bots.ConversationReference{ChannelId: bots.ChannelViber, Conversation: conversation("U2")},
+			receiver:  "U2",
+		},
+		{
+			name:      "user without id",
+			reference: &bots.ConversationReference{ChannelId: bots.ChannelViber, User: account(""), Conversation: conversation("U3")},
+			receiver:  "U3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.Reset()
+			_, err := bots.SendProactive(context.Background(), bot, tt.reference, &bots.Activity{Text: "hello"})
+
+			if tt.receiver == "" {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				if messages := server.Messages(); len(messages) != 0 {
+					t.Fatalf("unexpected messages %+v", messages)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if messages := server.Messages(); len(messages) != 1 || messages[0].Receiver != tt.receiver || messages[0].Text != "hello" {
+				t.Fatalf("unexpected messages %+v", messages)
+			}
+		})
+	}
+}
+
+func TestViberBroadcastConversationReference(t *testing.T) {
+	server := vibertest.NewServer("token")
+	defer server.Close()
+	bot, err := bots.NewViberBot(server.Config("https://example.com/viber"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	references := []*bots.ConversationReference{
+		{ChannelId: bots.ChannelViber, Conversation: conversation("U1")},
+		{ChannelId: bots.ChannelViber, User: account("U2")},
+		{ChannelId: bots.ChannelViber},
+	}
+
+	report, err := bot.Broadcast(references, &bots.Activity{Text: "news"}, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Results[0].Err != nil || report.Results[1].Err != nil || report.Results[2].Err == nil {
+		t.Fatalf("unexpected results %+v %+v %+v", report.Results[0], report.Results[1], report.Results[2])
+	}
+
+	messages := server.Messages()
+
+	if len(messages) != 2 || messages[0].Receiver != "U1" || messages[1].Receiver != "U2" {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+}
+
+func TestSendProactiveMSBotWithoutConversation(t *testing.T) {
+	server, err := msbottest.NewServer("app", "password")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+	bot := bots.NewMSBot(server.Settings())
+	defer bot.Close()
+	reference := &bots.ConversationReference{ChannelId: bots.ChannelWebChat, ServiceUrl: server.URL, User: account("user")}
+
+	if _, err := bots.SendProactive(context.Background(), bot, reference, &bots.Activity{Text: "hello"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if err := bot.Delete(reference.NewActivity("")); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if calls := server.Calls(); len(calls) != 0 {
+		t.Fatalf("unexpected connector calls %+v", calls)
+	}
+}
+
+func TestContinueConversation(t *testing.T) {
+	reference := &bots.ConversationReference{
+		ChannelId:    bots.ChannelViber,
+		ServiceUrl:   "https://example.com",
+		User:         account("U1"),
+		Bot:          account("bot"),
+		Conversation: conversation("U1"),
+	}
+
+	var activity *bots.Activity
+	err := bots.ContinueConversation(context.Background(), nil, reference, func(t *bots.Turn) {
+		activity = t.Activity
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if activity.Type != bots.TypeEvent || activity.Name != bots.ContinueConversationEvent || activity.ChannelId != bots.ChannelViber ||
+		activity.From.Id != "U1" || activity.Recipient.Id != "bot" || activity.Conversation.Id != "U1" {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	if err := bots.ContinueConversation(context.Background(), nil, &bots.ConversationReference{ChannelId: bots.ChannelViber}, func(turn *bots.Turn) {
+		t.Error("handler called for an invalid reference")
+	}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func account(id string) *bots.ChannelAccount {
+	return &bots.ChannelAccount{Identification: bots.Identification{Id: id}}
+}
+
+func conversation(id string) *bots.ConversationAccount {
+	return &bots.ConversationAccount{ChannelAccount: *account(id)}
+}
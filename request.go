@@ -0,0 +1,46 @@
+package bots
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/nickalie/bots/utils"
+	"github.com/parnurzeal/gorequest"
+)
+
+func endRequest(ctx context.Context, request *gorequest.SuperAgent) (*http.Response, []byte, error) {
+	if len(request.Errors) > 0 {
+		return nil, nil, utils.ErrorFromArray(request.Errors)
+	}
+
+	// End does this before building the request; MakeRequest alone ignores Type.
+	switch request.ForceType {
+	case "json", "form", "xml", "text", "multipart":
+		request.TargetType = request.ForceType
+	}
+
+	req, err := request.MakeRequest()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := request.Client
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, body, err
+}
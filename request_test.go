@@ -0,0 +1,117 @@
+package bots
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+func TestEndRequestEncoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestType string
+		contentType string
+	}{
+		{"json", "json", "application/json"},
+		{"form", "form", "application/x-www-form-urlencoded"},
+		{"multipart", "multipart", "multipart/form-data"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contentType string
+			var values url.Values
+			var fields map[string]string
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType, _, _ = mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+				switch contentType {
+				case "multipart/form-data":
+					r.ParseMultipartForm(1 << 20)
+					values = r.PostForm
+				case "application/x-www-form-urlencoded":
+					r.ParseForm()
+					values = r.PostForm
+				default:
+					body, _ := ioutil.ReadAll(r.Body)
+					json.Unmarshal(body, &fields)
+				}
+			}))
+
+			defer server.Close()
+			request := gorequest.New().Post(server.URL).Type(tt.requestType)
+			request.Send(map[string]string{"grant_type": "client_credentials", "client_id": "app"})
+			_, _, err := endRequest(context.Background(), request)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if contentType != tt.contentType {
+				t.Fatalf("Content-Type = %q, want %q", contentType, tt.contentType)
+			}
+
+			if values != nil {
+				fields = map[string]string{"grant_type": values.Get("grant_type"), "client_id": values.Get("client_id")}
+			}
+
+			if fields["grant_type"] != "client_credentials" || fields["client_id"] != "app" {
+				t.Fatalf("unexpected body %v", fields)
+			}
+		})
+	}
+}
+
+func TestEndRequestContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+
+	defer server.Close()
+	defer close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err := endRequest(ctx, gorequest.New().Get(server.URL))
+
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Fatalf("request was not aborted by the context")
+	}
+}
+
+func TestEndRequestRestoresBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	defer server.Close()
+	resp, body, err := endRequest(context.Background(), gorequest.New().Get(server.URL))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, _ := ioutil.ReadAll(resp.Body)
+
+	if string(body) != "hello" || string(again) != "hello" {
+		t.Fatalf("body = %q, resp.Body = %q", body, again)
+	}
+}
@@ -0,0 +1,136 @@
+package bots
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxRetries: 3,
+	MinBackoff: 500 * time.Millisecond,
+	MaxBackoff: 30 * time.Second,
+}
+
+type RetryPolicy struct {
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// defaultRetryPolicy copies DefaultRetryPolicy so that changing one bot's
+// policy does not affect the others.
+func defaultRetryPolicy() *RetryPolicy {
+	policy := *DefaultRetryPolicy
+	return &policy
+}
+
+type attemptFunc func() (*http.Response, []byte, error)
+type retryableFunc func(resp *http.Response, body []byte, err error) bool
+
+func (p *RetryPolicy) do(ctx context.Context, attempt attemptFunc, retryable retryableFunc) (*http.Response, []byte, error) {
+	for i := 0; ; i++ {
+		resp, body, err := attempt()
+
+		if p == nil || i >= p.MaxRetries || ctx.Err() != nil || !retryable(resp, body, err) {
+			return resp, body, err
+		}
+
+		timer := time.NewTimer(p.delay(i, resp))
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, body, err
+		}
+	}
+}
+
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if d, ok := retryAfter(resp); ok {
+		if p.MaxBackoff > 0 && d > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+
+		return d
+	}
+
+	backoff := p.MinBackoff << uint(attempt)
+
+	if backoff <= 0 || (p.MaxBackoff > 0 && backoff > p.MaxBackoff) {
+		backoff = p.MaxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+
+		if d < 0 {
+			d = 0
+		}
+
+		return d, true
+	}
+
+	return 0, false
+}
+
+func retryableFor(method string) retryableFunc {
+	idempotent := method == http.MethodGet || method == http.MethodHead || method == http.MethodPut ||
+		method == http.MethodDelete || method == http.MethodOptions
+
+	return func(resp *http.Response, body []byte, err error) bool {
+		if err != nil {
+			if idempotent {
+				_, ok := err.(net.Error)
+				return ok
+			}
+
+			return notSent(err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return true
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+			return idempotent
+		}
+
+		return false
+	}
+}
+
+func notSent(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+
+	e, ok := err.(*net.OpError)
+	return ok && e.Op == "dial"
+}
@@ -0,0 +1,215 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+		ok    bool
+	}{
+		{"missing", "", 0, 0, false},
+		{"seconds", "7", 7 * time.Second, 7 * time.Second, true},
+		{"zero", "0", 0, 0, true},
+		{"negative", "-3", 0, 0, false},
+		{"date", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute, true},
+		{"past date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0, true},
+		{"invalid", "soon", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+
+			if tt.value != "" {
+				resp.Header.Set("Retry-After", tt.value)
+			}
+
+			d, ok := retryAfter(resp)
+
+			if ok != tt.ok || d < tt.min || d > tt.max {
+				t.Fatalf("retryAfter(%q) = %v, %v, want %v..%v, %v", tt.value, d, ok, tt.min, tt.max, tt.ok)
+			}
+		})
+	}
+
+	if _, ok := retryAfter(nil); ok {
+		t.Fatal("retryAfter(nil) reported a delay")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := &RetryPolicy{MaxRetries: 5, MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	retryAfterResponse := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+
+	tests := []struct {
+		name    string
+		attempt int
+		resp    *http.Response
+		min     time.Duration
+		max     time.Duration
+	}{
+		{"first attempt", 0, nil, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"third attempt", 2, nil, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped", 10, nil, 500 * time.Millisecond, time.Second},
+		{"overflow", 80, nil, 500 * time.Millisecond, time.Second},
+		{"retry after", 0, retryAfterResponse("0"), 0, 0},
+		{"retry after capped", 0, retryAfterResponse("120"), time.Second, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if d := policy.delay(tt.attempt, tt.resp); d < tt.min || d > tt.max {
+					t.Fatalf("delay = %v, want %v..%v", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryableFor(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	readErr := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{Op: "read", Err: errors.New("connection reset")}}
+
+	tests := []struct {
+		method string
+		status int
+		err    error
+		want   bool
+	}{
+		{http.MethodPost, http.StatusTooManyRequests, nil, true},
+		{http.MethodPost, http.StatusServiceUnavailable, nil, true},
+		{http.MethodPost, http.StatusInternalServerError, nil, false},
+		{http.MethodPost, http.StatusBadGateway, nil, false},
+		{http.MethodPost, http.StatusBadRequest, nil, false},
+		{http.MethodPost, 0, dialErr, true},
+		{http.MethodPost, 0, readErr, false},
+		{http.MethodPost, 0, errors.New("other"), false},
+		{http.MethodGet, http.StatusInternalServerError, nil, true},
+		{http.MethodPut, http.StatusGatewayTimeout, nil, true},
+		{http.MethodDelete, http.StatusBadGateway, nil, true},
+		{http.MethodGet, http.StatusNotFound, nil, false},
+		{http.MethodGet, 0, readErr, true},
+		{http.MethodGet, 0, errors.New("other"), false},
+	}
+
+	for _, tt := range tests {
+		var resp *http.Response
+
+		if tt.err == nil {
+			resp = &http.Response{StatusCode: tt.status}
+		}
+
+		if got := retryableFor(tt.method)(resp, nil, tt.err); got != tt.want {
+			t.Errorf("retryableFor(%s)(%d, %v) = %v, want %v", tt.method, tt.status, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyPost(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		calls    int32
+		status   int
+	}{
+		{"throttled then ok", []int{429, 503, 200}, 3, 3, 200},
+		{"retries exhausted", []int{503, 503, 503}, 1, 2, 503},
+		{"server error is not retried", []int{500, 200}, 3, 1, 500},
+		{"no policy", []int{503, 200}, -1, 1, 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer server.Close()
+
+			var policy *RetryPolicy
+
+			if tt.retries >= 0 {
+				policy = &RetryPolicy{MaxRetries: tt.retries, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+			}
+
+			request := gorequest.New().Post(server.URL).Send(map[string]string{"text": "hi"})
+			resp, _, err := policy.do(context.Background(), func() (*http.Response, []byte, error) {
+				return endRequest(context.Background(), request)
+			}, retryableFor(request.Method))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.status || atomic.LoadInt32(&calls) != tt.calls {
+				t.Fatalf("status = %d after %d calls, want %d after %d", resp.StatusCode, calls, tt.status, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := &RetryPolicy{MaxRetries: 5, MinBackoff: time.Hour, MaxBackoff: time.Hour}
+	calls := 0
+	start := time.Now()
+
+	resp, _, _ := policy.do(ctx, func() (*http.Response, []byte, error) {
+		calls++
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}, nil, nil
+	}, retryableFor(http.MethodPost))
+
+	if calls != 1 || resp.StatusCode != http.StatusServiceUnavailable || time.Since(start) > time.Second {
+		t.Fatalf("calls = %d, status = %d after %v", calls, resp.StatusCode, time.Since(start))
+	}
+}
+
+func TestDefaultRetryPolicyIsCopied(t *testing.T) {
+	want := *DefaultRetryPolicy
+	msBot := NewMSBot(&MSBotSettings{})
+	defer msBot.Close()
+	viberBot, err := NewViberBot(&ViberBotConfig{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msBot.settings.Retry == DefaultRetryPolicy || viberBot.config.Retry == DefaultRetryPolicy {
+		t.Fatal("bots share DefaultRetryPolicy")
+	}
+
+	msBot.settings.Retry.MaxRetries = 10
+	viberBot.config.Retry.MaxBackoff = time.Hour
+
+	if *DefaultRetryPolicy != want {
+		t.Fatalf("DefaultRetryPolicy changed to %+v", *DefaultRetryPolicy)
+	}
+
+	custom := &RetryPolicy{MaxRetries: 1}
+
+	if bot := NewMSBot(&MSBotSettings{Retry: custom}); bot.settings.Retry != custom {
+		t.Fatal("custom retry policy was replaced")
+	}
+}
@@ -0,0 +1,516 @@
+package bots
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+const (
+	slackAPI           = "https://slack.com/api"
+	slackEventLifetime = 10 * time.Minute
+)
+
+var slackChannels = []string{ChannelSlack}
+
+type SlackBotConfig struct {
+	Token         string
+	SigningSecret string
+	APIEndpoint   string
+}
+
+type SlackBot struct {
+	config    *SlackBotConfig
+	updates   chan *Activity
+	lifecycle *lifecycle
+	mu        sync.Mutex
+	events    map[string]time.Time
+}
+
+func NewSlackBot(config *SlackBotConfig) *SlackBot {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = slackAPI
+	}
+
+	return &SlackBot{
+		config:    config,
+		updates:   make(chan *Activity),
+		lifecycle: newLifecycle(),
+		events:    make(map[string]time.Time),
+	}
+}
+
+func (b *SlackBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		errorResponse(w, "unable to read body")
+		return
+	}
+
+	if !b.validSignature(r, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var activity *Activity
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		form, err := url.ParseQuery(string(body))
+
+		if err != nil {
+			errorResponse(w, "invalid payload")
+			return
+		}
+
+		payload := &slackInteraction{}
+
+		if err = json.Unmarshal([]byte(form.Get("payload")), payload); err != nil {
+			errorResponse(w, "invalid payload")
+			return
+		}
+
+		activity = slackInteractionToActivity(payload)
+	} else {
+		envelope := &slackEnvelope{}
+
+		if err = json.Unmarshal(body, envelope); err != nil {
+			errorResponse(w, "invalid payload")
+			return
+		}
+
+		if envelope.Type == "url_verification" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(envelope.Challenge))
+			return
+		}
+
+		// Slack retries events it did not see acknowledged and sends a
+		// channel message that mentions the bot both as message and app_mention.
+		if envelope.Type == "event_callback" && envelope.Event != nil && !b.seen(envelope.EventId, envelope.Event.messageKey()) {
+			activity = slackEventToActivity(envelope.Event)
+		}
+	}
+
+	if activity == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	go func() {
+		defer b.lifecycle.leave()
+		b.lifecycle.deliver(b.updates, activity)
+	}()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *SlackBot) seen(keys ...string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+
+	for k, expires := range b.events {
+		if now.After(expires) {
+			delete(b.events, k)
+		}
+	}
+
+	duplicate := false
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		if _, ok := b.events[key]; ok {
+			duplicate = true
+		}
+
+		b.events[key] = now.Add(slackEventLifetime)
+	}
+
+	return duplicate
+}
+
+func (b *SlackBot) validSignature(r *http.Request, body []byte) bool {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil || math.Abs(float64(time.Now().Unix()-ts)) > 300 {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(b.config.SigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+func (b *SlackBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.updates, nil
+}
+
+func (b *SlackBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	return forwardUpdates(ctx, b.updates), nil
+}
+
+func (b *SlackBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *SlackBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if activity.Type == TypeTyping {
+		return nil, nil
+	}
+
+	channel, thread := slackConversation(activity)
+	message := slackMessage(activity)
+	message["channel"] = channel
+
+	if thread != "" {
+		message["thread_ts"] = thread
+	}
+
+	var result struct {
+		Ts string `json:"ts"`
+	}
+
+	err := b.call(ctx, "chat.postMessage", message, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identification{Id: result.Ts}, nil
+}
+
+func (b *SlackBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *SlackBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	channel, _ := slackConversation(activity)
+	message := slackMessage(activity)
+	message["channel"] = channel
+	message["ts"] = activity.Id
+	err := b.call(ctx, "chat.update", message, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identification{Id: activity.Id}, nil
+}
+
+func (b *SlackBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *SlackBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	channel, _ := slackConversation(activity)
+	return b.call(ctx, "chat.delete", map[string]interface{}{"channel": channel, "ts": activity.Id}, nil)
+}
+
+func (b *SlackBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *SlackBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, attachment.ContentUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+b.config.Token)
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func (b *SlackBot) GetChannels() []string {
+	return slackChannels
+}
+
+func (b *SlackBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *SlackBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *SlackBot) call(ctx context.Context, method string, payload interface{}, result interface{}) error {
+	request := gorequest.New().Post(b.config.APIEndpoint+"/"+method).
+		Set("Authorization", "Bearer "+b.config.Token).
+		Send(payload)
+	resp, body, err := endRequest(ctx, request)
+
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	err = json.Unmarshal(body, &response)
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("slack %s failed: %s %d", method, body, resp.StatusCode))
+	}
+
+	if !response.Ok {
+		return errors.New(fmt.Sprintf("slack %s failed: %s", method, response.Error))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+type slackEnvelope struct {
+	Type      string      `json:"type"`
+	Challenge string      `json:"challenge"`
+	EventId   string      `json:"event_id"`
+	Event     *slackEvent `json:"event"`
+}
+
+type slackFile struct {
+	Name               string `json:"name"`
+	Mimetype           string `json:"mimetype"`
+	UrlPrivate         string `json:"url_private"`
+	UrlPrivateDownload string `json:"url_private_download"`
+	Thumb360           string `json:"thumb_360"`
+}
+
+type slackEvent struct {
+	Type        string       `json:"type"`
+	Subtype     string       `json:"subtype"`
+	User        string       `json:"user"`
+	BotId       string       `json:"bot_id"`
+	Text        string       `json:"text"`
+	Channel     string       `json:"channel"`
+	ChannelType string       `json:"channel_type"`
+	Ts          string       `json:"ts"`
+	ThreadTs    string       `json:"thread_ts"`
+	Files       []*slackFile `json:"files"`
+}
+
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"user"`
+	Channel struct {
+		Id string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		Ts       string `json:"ts"`
+		ThreadTs string `json:"thread_ts"`
+	} `json:"message"`
+	Actions []struct {
+		ActionId string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+func (e *slackEvent) messageKey() string {
+	if e.Ts == "" {
+		return ""
+	}
+
+	return e.Channel + ":" + e.Ts
+}
+
+func slackEventToActivity(e *slackEvent) *Activity {
+	if e.BotId != "" || (e.Type != "message" && e.Type != "app_mention") {
+		return nil
+	}
+
+	if e.Subtype != "" && e.Subtype != "file_share" && e.Subtype != "thread_broadcast" {
+		return nil
+	}
+
+	result := &Activity{}
+	result.Id = e.Ts
+	result.ChannelId = ChannelSlack
+	result.Type = TypeMessage
+	result.Text = e.Text
+	result.From = &ChannelAccount{Identification: Identification{Id: e.User}}
+	result.Conversation = slackConversationAccount(e.Channel, e.ThreadTs, e.ChannelType != "im")
+
+	for _, f := range e.Files {
+		contentUrl := f.UrlPrivateDownload
+
+		if contentUrl == "" {
+			contentUrl = f.UrlPrivate
+		}
+
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType:  f.Mimetype,
+			ContentUrl:   contentUrl,
+			ThumbnailUrl: f.Thumb360,
+			Name:         f.Name,
+		})
+	}
+
+	return result
+}
+
+func slackInteractionToActivity(i *slackInteraction) *Activity {
+	if i.Type != "block_actions" || len(i.Actions) == 0 {
+		return nil
+	}
+
+	result := &Activity{}
+	result.Id = i.Message.Ts
+	result.ChannelId = ChannelSlack
+	result.Type = TypeMessage
+	result.Text = i.Actions[0].Value
+	result.From = &ChannelAccount{Identification: Identification{Id: i.User.Id}, Name: i.User.Name}
+	result.Conversation = slackConversationAccount(i.Channel.Id, i.Message.ThreadTs, !strings.HasPrefix(i.Channel.Id, "D"))
+	return result
+}
+
+func slackConversationAccount(channel, thread string, isGroup bool) *ConversationAccount {
+	id := channel
+
+	if thread != "" {
+		id += ":" + thread
+	}
+
+	return &ConversationAccount{
+		ChannelAccount: ChannelAccount{Identification: Identification{Id: id}},
+		IsGroup:        isGroup,
+	}
+}
+
+func slackConversation(activity *Activity) (string, string) {
+	id := targetConversationId(activity)
+
+	if i := strings.Index(id, ":"); i >= 0 {
+		return id[:i], id[i+1:]
+	}
+
+	return id, ""
+}
+
+func slackMessage(activity *Activity) map[string]interface{} {
+	message := map[string]interface{}{"text": activity.Text}
+	var blocks []interface{}
+
+	if activity.Text != "" {
+		blocks = append(blocks, slackSection(activity.Text))
+	}
+
+	for _, a := range activity.Attachments {
+		if a.ContentType == TypeHeroCard {
+			card, ok := a.Content.(*HeroCard)
+
+			if !ok {
+				continue
+			}
+
+			if text := joinText(slackBold(card.Title), card.Text); text != "" {
+				blocks = append(blocks, slackSection(text))
+			}
+
+			for _, image := range card.Images {
+				blocks = append(blocks, map[string]interface{}{"type": "image", "image_url": image.Url, "alt_text": slackAltText(image.Alt)})
+			}
+
+			if len(card.Buttons) > 0 {
+				blocks = append(blocks, slackActions(card.Buttons))
+			}
+		} else if strings.HasPrefix(a.ContentType, "image") {
+			blocks = append(blocks, map[string]interface{}{"type": "image", "image_url": a.ContentUrl, "alt_text": slackAltText(a.Name)})
+		}
+	}
+
+	if activity.SuggestedActions != nil && len(activity.SuggestedActions.Actions) > 0 {
+		blocks = append(blocks, slackActions(activity.SuggestedActions.Actions))
+	}
+
+	if len(blocks) > 0 {
+		message["blocks"] = blocks
+	}
+
+	return message
+}
+
+func slackSection(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+}
+
+func slackActions(actions []*CardAction) map[string]interface{} {
+	elements := make([]map[string]interface{}, 0)
+
+	for i, action := range actions {
+		button := map[string]interface{}{
+			"type":      "button",
+			"text":      map[string]string{"type": "plain_text", "text": action.Title},
+			"action_id": "action_" + strconv.Itoa(i),
+		}
+
+		if action.Type == TypeOpenUrl {
+			button["url"] = action.Value
+		} else {
+			button["value"] = action.Value
+		}
+
+		elements = append(elements, button)
+	}
+
+	return map[string]interface{}{"type": "actions", "elements": elements}
+}
+
+func slackBold(text string) string {
+	if text == "" {
+		return ""
+	}
+
+	return "*" + text + "*"
+}
+
+func slackAltText(alt string) string {
+	if alt == "" {
+		return "image"
+	}
+
+	return alt
+}
@@ -0,0 +1,229 @@
+package bots
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func slackSignature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func slackRequest(body string) *http.Request {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	r := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Slack-Request-Timestamp", now)
+	r.Header.Set("X-Slack-Signature", slackSignature("secret", now, body))
+	return r
+}
+
+// serveSlack serves the requests, shuts the bot down and returns every
+// activity the bot delivered.
+func serveSlack(t *testing.T, bot *SlackBot, requests ...*http.Request) ([]*httptest.ResponseRecorder, []*Activity) {
+	received := make(chan []*Activity)
+
+	go func() {
+		var activities []*Activity
+
+		for activity := range bot.updates {
+			activities = append(activities, activity)
+		}
+
+		received <- activities
+	}()
+
+	var recorders []*httptest.ResponseRecorder
+
+	for _, r := range requests {
+		w := httptest.NewRecorder()
+		bot.ServeHTTP(w, r)
+		recorders = append(recorders, w)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := bot.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return recorders, <-received
+}
+
+func TestSlackSignature(t *testing.T) {
+	body := `{"type":"event_callback","event":{"type":"message","user":"U1","text":"hi","channel":"C1","channel_type":"im","ts":"1.1"}}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	expired := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		body      string
+		timestamp string
+		signature string
+		status    int
+	}{
+		{"valid", body, now, slackSignature("secret", now, body), http.StatusOK},
+		{"tampered body", strings.Replace(body, "hi", "bye", 1), now, slackSignature("secret", now, body), http.StatusUnauthorized},
+		{"wrong secret", body, now, slackSignature("other", now, body), http.StatusUnauthorized},
+		{"expired", body, expired, slackSignature("secret", expired, body), http.StatusUnauthorized},
+		{"missing signature", body, now, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewSlackBot(&SlackBotConfig{SigningSecret: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("X-Slack-Request-Timestamp", tt.timestamp)
+			r.Header.Set("X-Slack-Signature", tt.signature)
+			w, activities := serveSlack(t, bot, r)
+
+			if w[0].Code != tt.status {
+				t.Fatalf("status = %d, want %d", w[0].Code, tt.status)
+			}
+
+			if tt.status != http.StatusOK {
+				if len(activities) != 0 {
+					t.Fatalf("unexpected activities %+v", activities)
+				}
+
+				return
+			}
+
+			if len(activities) != 1 || activities[0].Text != "hi" || activities[0].Conversation.Id != "C1" {
+				t.Fatalf("unexpected activities %+v", activities)
+			}
+		})
+	}
+}
+
+func TestSlackURLVerification(t *testing.T) {
+	body := `{"type":"url_verification","challenge":"abc"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	bot := NewSlackBot(&SlackBotConfig{SigningSecret: "secret"})
+	r := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", now)
+	r.Header.Set("X-Slack-Signature", slackSignature("secret", now, body))
+	w, _ := serveSlack(t, bot, r)
+
+	if w[0].Code != http.StatusOK || w[0].Body.String() != "abc" {
+		t.Fatalf("got %d %q", w[0].Code, w[0].Body.String())
+	}
+}
+
+func TestSlackAcknowledgesBeforeDelivery(t *testing.T) {
+	bot := NewSlackBot(&SlackBotConfig{SigningSecret: "secret"})
+	body := `{"type":"event_callback","event_id":"E1","event":{"type":"message","user":"U1","text":"hi","channel":"C1","channel_type":"im","ts":"1.1"}}`
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		w := httptest.NewRecorder()
+		bot.ServeHTTP(w, slackRequest(body))
+		done <- w
+	}()
+
+	select {
+	case w := <-done:
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d", w.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request blocked until the update was read")
+	}
+
+	select {
+	case activity := <-bot.updates:
+		if activity.Text != "hi" {
+			t.Fatalf("unexpected activity %+v", activity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("acknowledged update was not delivered")
+	}
+}
+
+func TestSlackDeduplicatesEvents(t *testing.T) {
+	message := `{"type":"event_callback","event_id":"E1","event":{"type":"message","user":"U1","text":"<@B1> hi","channel":"C1","channel_type":"channel","ts":"1.1"}}`
+	retry := slackRequest(message)
+	retry.Header.Set("X-Slack-Retry-Num", "1")
+	retry.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+
+	tests := []struct {
+		name     string
+		requests []*http.Request
+		texts    []string
+	}{
+		{"retry", []*http.Request{slackRequest(message), retry}, []string{"<@B1> hi"}},
+		{"mention", []*http.Request{
+			slackRequest(message),
+			slackRequest(`{"type":"event_callback","event_id":"E2","event":{"type":"app_mention","user":"U1","text":"<@B1> hi","channel":"C1","ts":"1.1"}}`),
+		}, []string{"<@B1> hi"}},
+		{"mention only", []*http.Request{
+			slackRequest(`{"type":"event_callback","event_id":"E2","event":{"type":"app_mention","user":"U1","text":"<@B1> hi","channel":"C1","ts":"1.1"}}`),
+		}, []string{"<@B1> hi"}},
+		{"distinct messages", []*http.Request{
+			slackRequest(message),
+			slackRequest(`{"type":"event_callback","event_id":"E3","event":{"type":"message","user":"U1","text":"again","channel":"C1","channel_type":"channel","ts":"1.2"}}`),
+			slackRequest(`{"type":"event_callback","event_id":"E4","event":{"type":"message","user":"U1","text":"elsewhere","channel":"C2","channel_type":"channel","ts":"1.1"}}`),
+		}, []string{"<@B1> hi", "again", "elsewhere"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewSlackBot(&SlackBotConfig{SigningSecret: "secret"})
+			recorders, activities := serveSlack(t, bot, tt.requests...)
+
+			for i, w := range recorders {
+				if w.Code != http.StatusOK {
+					t.Fatalf("request %d status = %d", i, w.Code)
+				}
+			}
+
+			texts := make(map[string]int)
+
+			for _, activity := range activities {
+				texts[activity.Text]++
+			}
+
+			if len(activities) != len(tt.texts) {
+				t.Fatalf("got %d activities %v, want %v", len(activities), texts, tt.texts)
+			}
+
+			for _, text := range tt.texts {
+				if texts[text] != 1 {
+					t.Fatalf("got activities %v, want %v once each", texts, tt.texts)
+				}
+			}
+		})
+	}
+}
+
+func TestSlackSeenExpires(t *testing.T) {
+	bot := NewSlackBot(&SlackBotConfig{})
+
+	if bot.seen("E1", "") || !bot.seen("E1") {
+		t.Fatal("event was not remembered")
+	}
+
+	bot.mu.Lock()
+	bot.events["E1"] = time.Now().Add(-time.Second)
+	bot.mu.Unlock()
+
+	if bot.seen("E2") || bot.seen("E1") {
+		t.Fatal("expired event was still remembered")
+	}
+
+	if _, ok := bot.events[""]; ok {
+		t.Fatal("empty key was remembered")
+	}
+}
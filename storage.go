@@ -0,0 +1,284 @@
+package bots
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("storage: item not found")
+	ErrETagConflict = errors.New("storage: etag conflict")
+)
+
+const (
+	AnyETag              = "*"
+	stateConflictRetries = 3
+)
+
+type StoreItem struct {
+	Data []byte `json:"data"`
+	ETag string `json:"etag"`
+}
+
+type Storage interface {
+	Read(ctx context.Context, key string) (*StoreItem, error)
+	Write(ctx context.Context, key string, item *StoreItem) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func ConversationStateKey(a *Activity) string {
+	return a.ChannelId + "/conversations/" + conversationId(a)
+}
+
+func UserStateKey(a *Activity) string {
+	return a.ChannelId + "/users/" + userId(a)
+}
+
+func PrivateConversationStateKey(a *Activity) string {
+	return a.ChannelId + "/conversations/" + conversationId(a) + "/users/" + userId(a)
+}
+
+func conversationId(a *Activity) string {
+	if a.Conversation == nil {
+		return ""
+	}
+
+	return a.Conversation.Id
+}
+
+func userId(a *Activity) string {
+	if a.From == nil {
+		return ""
+	}
+
+	return a.From.Id
+}
+
+var etagCounter uint64
+
+func NewETag() string {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(b[8:], atomic.AddUint64(&etagCounter, 1))
+	}
+
+	return hex.EncodeToString(b)
+}
+
+type State struct {
+	Conversation        map[string]interface{}
+	User                map[string]interface{}
+	PrivateConversation map[string]interface{}
+	slots               []*stateSlot
+}
+
+type stateSlot struct {
+	key  string
+	data *map[string]interface{}
+	raw  []byte
+	etag string
+}
+
+type StateConflictError struct {
+	Key   string
+	Saved []string
+}
+
+func (e *StateConflictError) Error() string {
+	return fmt.Sprintf("storage: etag conflict saving %s, saved: %v", e.Key, e.Saved)
+}
+
+func (e *StateConflictError) Unwrap() error {
+	return ErrETagConflict
+}
+
+type BotState struct {
+	storage      Storage
+	errorHandler ErrorHandlerFunc
+}
+
+func NewBotState(storage Storage) *BotState {
+	return &BotState{storage: storage}
+}
+
+func (s *BotState) HandleError(handler ErrorHandlerFunc) {
+	s.errorHandler = handler
+}
+
+func (s *BotState) Load(ctx context.Context, a *Activity) (*State, error) {
+	state := &State{}
+	state.slots = []*stateSlot{
+		{key: ConversationStateKey(a), data: &state.Conversation},
+		{key: UserStateKey(a), data: &state.User},
+		{key: PrivateConversationStateKey(a), data: &state.PrivateConversation},
+	}
+
+	for _, slot := range state.slots {
+		item, err := s.storage.Read(ctx, slot.key)
+
+		if err == ErrNotFound {
+			*slot.data = make(map[string]interface{})
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(item.Data, slot.data)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if *slot.data == nil {
+			*slot.data = make(map[string]interface{})
+		}
+
+		slot.raw = item.Data
+		slot.etag = item.ETag
+	}
+
+	return state, nil
+}
+
+func (s *BotState) Save(ctx context.Context, state *State) error {
+	var saved []string
+
+	for _, slot := range state.slots {
+		data, err := json.Marshal(*slot.data)
+
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(data, slot.raw) {
+			continue
+		}
+
+		etag, err := s.storage.Write(ctx, slot.key, &StoreItem{Data: data, ETag: slot.etag})
+
+		for i := 0; err == ErrETagConflict && i < stateConflictRetries; i++ {
+			var merged []byte
+			merged, etag, err = s.merge(ctx, slot, data)
+
+			if err == nil {
+				data = merged
+			}
+		}
+
+		if err == ErrETagConflict {
+			return &StateConflictError{Key: slot.key, Saved: saved}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		slot.raw = data
+		slot.etag = etag
+		saved = append(saved, slot.key)
+	}
+
+	return nil
+}
+
+// merge reapplies the top-level keys changed during the turn on top of the
+// stored value and writes the result with the stored ETag.
+func (s *BotState) merge(ctx context.Context, slot *stateSlot, data []byte) ([]byte, string, error) {
+	original := make(map[string]interface{})
+	changed := make(map[string]interface{})
+	current := make(map[string]interface{})
+	etag := ""
+
+	if slot.raw != nil {
+		if err := json.Unmarshal(slot.raw, &original); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := json.Unmarshal(data, &changed); err != nil {
+		return nil, "", err
+	}
+
+	item, err := s.storage.Read(ctx, slot.key)
+
+	if err != nil && err != ErrNotFound {
+		return nil, "", err
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(item.Data, &current); err != nil {
+			return nil, "", err
+		}
+
+		etag = item.ETag
+	}
+
+	if current == nil {
+		current = make(map[string]interface{})
+	}
+
+	for k, v := range changed {
+		if old, ok := original[k]; !ok || !reflect.DeepEqual(old, v) {
+			current[k] = v
+		}
+	}
+
+	for k := range original {
+		if _, ok := changed[k]; !ok {
+			delete(current, k)
+		}
+	}
+
+	merged, err := json.Marshal(current)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	etag, err = s.storage.Write(ctx, slot.key, &StoreItem{Data: merged, ETag: etag})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	*slot.data = current
+	return merged, etag, nil
+}
+
+func (s *BotState) Handler(handler HandlerFunc) HandlerFunc {
+	return func(t *Turn) {
+		state, err := s.Load(t.Context(), t.Activity)
+
+		if err != nil {
+			s.handleError(t, err)
+			return
+		}
+
+		t.State = state
+		handler(t)
+		err = s.Save(t.Context(), state)
+
+		if err != nil {
+			s.handleError(t, err)
+		}
+	}
+}
+
+func (s *BotState) handleError(t *Turn, err error) {
+	if s.errorHandler != nil {
+		s.errorHandler(t, err)
+	}
+}
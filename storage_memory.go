@@ -0,0 +1,48 @@
+package bots
+
+import (
+	"context"
+	"sync"
+)
+
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	items map[string]StoreItem
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{items: make(map[string]StoreItem)}
+}
+
+func (s *MemoryStorage) Read(ctx context.Context, key string) (*StoreItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[key]
+
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &StoreItem{Data: append([]byte(nil), item.Data...), ETag: item.ETag}, nil
+}
+
+func (s *MemoryStorage) Write(ctx context.Context, key string, item *StoreItem) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.items[key]
+
+	if item.ETag != AnyETag && ((ok && current.ETag != item.ETag) || (!ok && item.ETag != "")) {
+		return "", ErrETagConflict
+	}
+
+	etag := NewETag()
+	s.items[key] = StoreItem{Data: append([]byte(nil), item.Data...), ETag: etag}
+	return etag, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+	return nil
+}
@@ -0,0 +1,135 @@
+package bots
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+)
+
+type SQLStorageConfig struct {
+	Table       string
+	Placeholder func(n int) string
+}
+
+type SQLStorage struct {
+	db     *sql.DB
+	config *SQLStorageConfig
+}
+
+func QuestionPlaceholder(n int) string {
+	return "?"
+}
+
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func NewSQLStorage(db *sql.DB, config *SQLStorageConfig) *SQLStorage {
+	if config == nil {
+		config = &SQLStorageConfig{}
+	}
+
+	if config.Table == "" {
+		config.Table = "bot_state"
+	}
+
+	if config.Placeholder == nil {
+		config.Placeholder = QuestionPlaceholder
+	}
+
+	return &SQLStorage{db: db, config: config}
+}
+
+func (s *SQLStorage) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (state_key VARCHAR(255) PRIMARY KEY, data TEXT NOT NULL, etag VARCHAR(64) NOT NULL)",
+		s.config.Table))
+	return err
+}
+
+func (s *SQLStorage) Read(ctx context.Context, key string) (*StoreItem, error) {
+	var data, etag string
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT data, etag FROM %s WHERE state_key = %s",
+		s.config.Table, s.config.Placeholder(1)), key)
+	err := row.Scan(&data, &etag)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &StoreItem{Data: []byte(data), ETag: etag}, nil
+}
+
+func (s *SQLStorage) Write(ctx context.Context, key string, item *StoreItem) (string, error) {
+	etag := NewETag()
+	p := s.config.Placeholder
+
+	switch item.ETag {
+	case "":
+		return s.insert(ctx, key, item.Data, etag)
+	case AnyETag:
+		updated, err := s.update(ctx, fmt.Sprintf("UPDATE %s SET data = %s, etag = %s WHERE state_key = %s",
+			s.config.Table, p(1), p(2), p(3)), string(item.Data), etag, key)
+
+		if err != nil {
+			return "", err
+		}
+
+		if updated {
+			return etag, nil
+		}
+
+		return s.insert(ctx, key, item.Data, etag)
+	default:
+		updated, err := s.update(ctx, fmt.Sprintf("UPDATE %s SET data = %s, etag = %s WHERE state_key = %s AND etag = %s",
+			s.config.Table, p(1), p(2), p(3), p(4)), string(item.Data), etag, key, item.ETag)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !updated {
+			return "", ErrETagConflict
+		}
+
+		return etag, nil
+	}
+}
+
+func (s *SQLStorage) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE state_key = %s",
+		s.config.Table, s.config.Placeholder(1)), key)
+	return err
+}
+
+func (s *SQLStorage) insert(ctx context.Context, key string, data []byte, etag string) (string, error) {
+	p := s.config.Placeholder
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (state_key, data, etag) VALUES (%s, %s, %s)",
+		s.config.Table, p(1), p(2), p(3)), key, string(data), etag)
+
+	if err == nil {
+		return etag, nil
+	}
+
+	if _, readErr := s.Read(ctx, key); readErr == nil {
+		return "", ErrETagConflict
+	}
+
+	return "", err
+}
+
+func (s *SQLStorage) update(ctx context.Context, query string, args ...interface{}) (bool, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
@@ -0,0 +1,627 @@
+package bots_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/boltstorage"
+)
+
+func TestStorageETags(t *testing.T) {
+	for _, test := range storages() {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := test.open(t)
+
+			if _, err := s.Read(ctx, "key"); err != bots.ErrNotFound {
+				t.Fatalf("read missing = %v, want ErrNotFound", err)
+			}
+
+			if _, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{}`), ETag: "stale"}); err != bots.ErrETagConflict {
+				t.Fatalf("write missing with etag = %v, want ErrETagConflict", err)
+			}
+
+			first, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{"n":1}`)})
+
+			if err != nil || first == "" {
+				t.Fatalf("create = %q, %v", first, err)
+			}
+
+			if _, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{"n":2}`)}); err != bots.ErrETagConflict {
+				t.Fatalf("create existing = %v, want ErrETagConflict", err)
+			}
+
+			item, err := s.Read(ctx, "key")
+
+			if err != nil || string(item.Data) != `{"n":1}` || item.ETag != first {
+				t.Fatalf("read = %+v, %v", item, err)
+			}
+
+			second, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{"n":2}`), ETag: first})
+
+			if err != nil || second == "" || second == first {
+				t.Fatalf("update = %q, %v (previous etag %q)", second, err, first)
+			}
+
+			if _, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{"n":3}`), ETag: first}); err != bots.ErrETagConflict {
+				t.Fatalf("update with stale etag = %v, want ErrETagConflict", err)
+			}
+
+			if _, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{"n":4}`), ETag: bots.AnyETag}); err != nil {
+				t.Fatalf("update with any etag: %v", err)
+			}
+
+			if _, err := s.Write(ctx, "other", &bots.StoreItem{Data: []byte(`{}`), ETag: bots.AnyETag}); err != nil {
+				t.Fatalf("create with any etag: %v", err)
+			}
+
+			item, err = s.Read(ctx, "key")
+
+			if err != nil || string(item.Data) != `{"n":4}` {
+				t.Fatalf("read = %+v, %v", item, err)
+			}
+
+			if err := s.Delete(ctx, "key"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.Read(ctx, "key"); err != bots.ErrNotFound {
+				t.Fatalf("read deleted = %v, want ErrNotFound", err)
+			}
+
+			if err := s.Delete(ctx, "key"); err != nil {
+				t.Fatalf("delete missing: %v", err)
+			}
+		})
+	}
+}
+
+func TestStorageConcurrentWrites(t *testing.T) {
+	for _, test := range storages() {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := test.open(t)
+			etag, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(`{}`)})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			results := map[error]int{}
+
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+
+				go func(i int) {
+					defer wg.Done()
+					_, err := s.Write(ctx, "key", &bots.StoreItem{Data: []byte(fmt.Sprintf(`{"n":%d}`, i)), ETag: etag})
+					mu.Lock()
+					results[err]++
+					mu.Unlock()
+				}(i)
+			}
+
+			wg.Wait()
+
+			if results[nil] != 1 || results[bots.ErrETagConflict] != 7 {
+				t.Fatalf("results = %v, want one success and 7 conflicts", results)
+			}
+		})
+	}
+}
+
+func TestSQLStorageConfig(t *testing.T) {
+	db := openFakeSQL(t)
+	s := bots.NewSQLStorage(db, &bots.SQLStorageConfig{Table: "custom_state", Placeholder: bots.DollarPlaceholder})
+
+	if _, err := s.Write(context.Background(), "key", &bots.StoreItem{Data: []byte(`{}`)}); err == nil {
+		t.Fatal("expected an error before the table is created")
+	}
+
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Write(context.Background(), "key", &bots.StoreItem{Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if queries := fakeSQL.queries(t.Name()); !containsQuery(queries, "SELECT data, etag FROM custom_state WHERE state_key = $1") ||
+		!containsQuery(queries, "INSERT INTO custom_state (state_key, data, etag) VALUES ($1, $2, $3)") {
+		t.Fatalf("queries = %q", queries)
+	}
+}
+
+func TestBotStateMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial map[string]interface{}
+		first   func(m map[string]interface{})
+		second  func(m map[string]interface{})
+		want    map[string]interface{}
+	}{
+		{
+			name:    "different keys",
+			initial: map[string]interface{}{},
+			first:   func(m map[string]interface{}) { m["a"] = 1.0 },
+			second:  func(m map[string]interface{}) { m["b"] = 2.0 },
+			want:    map[string]interface{}{"a": 1.0, "b": 2.0},
+		},
+		{
+			name:    "same key",
+			initial: map[string]interface{}{"a": 0.0},
+			first:   func(m map[string]interface{}) { m["a"] = 1.0 },
+			second:  func(m map[string]interface{}) { m["a"] = 2.0 },
+			want:    map[string]interface{}{"a": 2.0},
+		},
+		{
+			name:    "deleted key",
+			initial: map[string]interface{}{"x": 1.0, "y": 1.0},
+			first:   func(m map[string]interface{}) { m["x"] = 2.0 },
+			second:  func(m map[string]interface{}) { delete(m, "y") },
+			want:    map[string]interface{}{"x": 2.0},
+		},
+		{
+			name:    "untouched key",
+			initial: map[string]interface{}{"x": 1.0, "y": 1.0},
+			first:   func(m map[string]interface{}) { m["y"] = 2.0 },
+			second:  func(m map[string]interface{}) { m["x"] = 3.0 },
+			want:    map[string]interface{}{"x": 3.0, "y": 2.0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := bots.NewMemoryStorage()
+			activity := stateActivity()
+			key := bots.ConversationStateKey(activity)
+			data, _ := json.Marshal(test.initial)
+
+			if _, err := storage.Write(ctx, key, &bots.StoreItem{Data: data}); err != nil {
+				t.Fatal(err)
+			}
+
+			state := bots.NewBotState(storage)
+			first, err := state.Load(ctx, activity)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			second, err := state.Load(ctx, activity)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.first(first.Conversation)
+			test.second(second.Conversation)
+
+			if err := state.Save(ctx, first); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := state.Save(ctx, second); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(second.Conversation, test.want) {
+				t.Errorf("merged state = %v, want %v", second.Conversation, test.want)
+			}
+
+			loaded, err := state.Load(ctx, activity)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(loaded.Conversation, test.want) {
+				t.Errorf("stored state = %v, want %v", loaded.Conversation, test.want)
+			}
+
+			second.Conversation["c"] = 3.0
+
+			if err := state.Save(ctx, second); err != nil {
+				t.Errorf("save after merge: %v", err)
+			}
+		})
+	}
+}
+
+func TestBotStatePersistentConflict(t *testing.T) {
+	ctx := context.Background()
+	activity := stateActivity()
+	storage := &conflictStorage{Storage: bots.NewMemoryStorage(), key: bots.PrivateConversationStateKey(activity)}
+	state := bots.NewBotState(storage)
+	s, err := state.Load(ctx, activity)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Conversation["a"] = 1.0
+	s.PrivateConversation["b"] = 2.0
+	err = state.Save(ctx, s)
+	conflict, ok := err.(*bots.StateConflictError)
+
+	if !ok {
+		t.Fatalf("save = %v, want *StateConflictError", err)
+	}
+
+	if !errors.Is(err, bots.ErrETagConflict) {
+		t.Error("StateConflictError does not unwrap to ErrETagConflict")
+	}
+
+	if conflict.Key != storage.key || !reflect.DeepEqual(conflict.Saved, []string{bots.ConversationStateKey(activity), bots.UserStateKey(activity)}) {
+		t.Errorf("conflict = %+v", conflict)
+	}
+
+	if storage.writes != 4 {
+		t.Errorf("writes to %s = %d, want 4", storage.key, storage.writes)
+	}
+}
+
+func TestBotStateHandler(t *testing.T) {
+	activity := stateActivity()
+	storage := bots.NewMemoryStorage()
+	state := bots.NewBotState(storage)
+	handler := state.Handler(func(t *bots.Turn) {
+		count, _ := t.State.User["count"].(float64)
+		t.State.User["count"] = count + 1
+	})
+
+	for i := 0; i < 3; i++ {
+		handler(stateTurn(activity))
+	}
+
+	item, err := storage.Read(context.Background(), bots.UserStateKey(activity))
+
+	if err != nil || string(item.Data) != `{"count":3}` {
+		t.Fatalf("user state = %+v, %v", item, err)
+	}
+
+	failing := bots.NewBotState(&failingStorage{})
+	called := false
+	failing.Handler(func(t *bots.Turn) { called = true })(stateTurn(activity))
+
+	if called {
+		t.Fatal("handler ran although the state failed to load")
+	}
+
+	var reported error
+	failing.HandleError(func(t *bots.Turn, err error) { reported = err })
+	failing.Handler(func(t *bots.Turn) {})(stateTurn(activity))
+
+	if reported != errStorageDown {
+		t.Fatalf("reported error = %v, want %v", reported, errStorageDown)
+	}
+}
+
+var errStorageDown = errors.New("storage down")
+
+type failingStorage struct{}
+
+func (s *failingStorage) Read(ctx context.Context, key string) (*bots.StoreItem, error) {
+	return nil, errStorageDown
+}
+
+func (s *failingStorage) Write(ctx context.Context, key string, item *bots.StoreItem) (string, error) {
+	return "", errStorageDown
+}
+
+func (s *failingStorage) Delete(ctx context.Context, key string) error {
+	return errStorageDown
+}
+
+type conflictStorage struct {
+	bots.Storage
+	key    string
+	writes int
+}
+
+func (s *conflictStorage) Write(ctx context.Context, key string, item *bots.StoreItem) (string, error) {
+	if key == s.key {
+		s.writes++
+		return "", bots.ErrETagConflict
+	}
+
+	return s.Storage.Write(ctx, key, item)
+}
+
+func stateActivity() *bots.Activity {
+	return &bots.Activity{
+		Type:         bots.TypeMessage,
+		ChannelId:    "test",
+		From:         &bots.ChannelAccount{Id: "user"},
+		Conversation: &bots.ConversationAccount{Id: "conversation"},
+	}
+}
+
+func stateTurn(activity *bots.Activity) *bots.Turn {
+	d := bots.NewDispatcher(nil, 1)
+	var turn *bots.Turn
+	d.HandleDefault(func(t *bots.Turn) { turn = t })
+	d.Dispatch(context.Background(), activity)
+	return turn
+}
+
+type storageCase struct {
+	name string
+	open func(t *testing.T) bots.Storage
+}
+
+func storages() []storageCase {
+	return []storageCase{
+		{"memory", func(t *testing.T) bots.Storage {
+			return bots.NewMemoryStorage()
+		}},
+		{"sql", func(t *testing.T) bots.Storage {
+			return openSQLStorage(t, nil)
+		}},
+		{"sql dollar placeholders", func(t *testing.T) bots.Storage {
+			return openSQLStorage(t, &bots.SQLStorageConfig{Placeholder: bots.DollarPlaceholder})
+		}},
+		{"bolt", func(t *testing.T) bots.Storage {
+			s, err := boltstorage.New(filepath.Join(t.TempDir(), "state.db"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			t.Cleanup(func() { s.Close() })
+			return s
+		}},
+	}
+}
+
+func openSQLStorage(t *testing.T, config *bots.SQLStorageConfig) *bots.SQLStorage {
+	s := bots.NewSQLStorage(openFakeSQL(t), config)
+
+	if err := s.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func openFakeSQL(t *testing.T) *sql.DB {
+	db, err := sql.Open("bots-fake", t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func containsQuery(queries []string, query string) bool {
+	for _, q := range queries {
+		if q == query {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fakeSQLDriver understands exactly the statements SQLStorage issues, with
+// the semantics of a table whose state_key is the primary key.
+type fakeSQLDriver struct {
+	mu      sync.Mutex
+	tables  map[string]map[string][2]string
+	history map[string][]string
+}
+
+var fakeSQL = &fakeSQLDriver{
+	tables:  map[string]map[string][2]string{},
+	history: map[string][]string{},
+}
+
+func init() {
+	sql.Register("bots-fake", fakeSQL)
+}
+
+var (
+	fakeSQLPlaceholder = regexp.MustCompile(`\?|\$\d+`)
+	fakeSQLCreate      = regexp.MustCompile(`^CREATE TABLE IF NOT EXISTS (\w+) \(`)
+	fakeSQLSelect      = regexp.MustCompile(`^SELECT data, etag FROM (\w+) WHERE state_key = \?$`)
+	fakeSQLInsert      = regexp.MustCompile(`^INSERT INTO (\w+) \(state_key, data, etag\) VALUES \(\?, \?, \?\)$`)
+	fakeSQLUpdate      = regexp.MustCompile(`^UPDATE (\w+) SET data = \?, etag = \? WHERE state_key = \?( AND etag = \?)?$`)
+	fakeSQLDelete      = regexp.MustCompile(`^DELETE FROM (\w+) WHERE state_key = \?$`)
+)
+
+func (d *fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	return &fakeSQLConn{driver: d, db: name}, nil
+}
+
+func (d *fakeSQLDriver) queries(db string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.history[db]...)
+}
+
+func (d *fakeSQLDriver) exec(db, query string, args []driver.Value) (int64, [][]driver.Value, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.history[db] = append(d.history[db], query)
+	query = fakeSQLPlaceholder.ReplaceAllString(query, "?")
+
+	if m := fakeSQLCreate.FindStringSubmatch(query); m != nil {
+		if d.tables[db+"/"+m[1]] == nil {
+			d.tables[db+"/"+m[1]] = map[string][2]string{}
+		}
+
+		return 0, nil, nil
+	}
+
+	str := func(i int) string {
+		switch v := args[i].(type) {
+		case string:
+			return v
+		case []byte:
+			return string(v)
+		}
+
+		return fmt.Sprint(args[i])
+	}
+
+	table := func(m []string) (map[string][2]string, error) {
+		rows, ok := d.tables[db+"/"+m[1]]
+
+		if !ok {
+			return nil, errors.New("no such table: " + m[1])
+		}
+
+		return rows, nil
+	}
+
+	if m := fakeSQLSelect.FindStringSubmatch(query); m != nil {
+		rows, err := table(m)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if row, ok := rows[str(0)]; ok {
+			return 0, [][]driver.Value{{row[0], row[1]}}, nil
+		}
+
+		return 0, nil, nil
+	}
+
+	if m := fakeSQLInsert.FindStringSubmatch(query); m != nil {
+		rows, err := table(m)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if _, ok := rows[str(0)]; ok {
+			return 0, nil, errors.New("duplicate key: " + str(0))
+		}
+
+		rows[str(0)] = [2]string{str(1), str(2)}
+		return 1, nil, nil
+	}
+
+	if m := fakeSQLUpdate.FindStringSubmatch(query); m != nil {
+		rows, err := table(m)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		row, ok := rows[str(2)]
+
+		if !ok || (m[2] != "" && row[1] != str(3)) {
+			return 0, nil, nil
+		}
+
+		rows[str(2)] = [2]string{str(0), str(1)}
+		return 1, nil, nil
+	}
+
+	if m := fakeSQLDelete.FindStringSubmatch(query); m != nil {
+		rows, err := table(m)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if _, ok := rows[str(0)]; !ok {
+			return 0, nil, nil
+		}
+
+		delete(rows, str(0))
+		return 1, nil, nil
+	}
+
+	return 0, nil, errors.New("unexpected query: " + query)
+}
+
+type fakeSQLConn struct {
+	driver *fakeSQLDriver
+	db     string
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeSQLConn) Close() error {
+	return nil
+}
+
+func (c *fakeSQLConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+type fakeSQLStmt struct {
+	conn  *fakeSQLConn
+	query string
+}
+
+func (s *fakeSQLStmt) Close() error {
+	return nil
+}
+
+func (s *fakeSQLStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	affected, _, err := s.conn.driver.exec(s.conn.db, s.query, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(affected), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.conn.driver.exec(s.conn.db, s.query, args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeSQLRows{rows: rows}, nil
+}
+
+type fakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	return []string{"data", "etag"}
+}
+
+func (r *fakeSQLRows) Close() error {
+	return nil
+}
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,676 @@
+package bots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+const (
+	telegramAPI            = "https://api.telegram.org"
+	telegramPollMinBackoff = time.Second
+	telegramPollMaxBackoff = time.Minute
+)
+
+var telegramChannels = []string{ChannelTelegram}
+
+type TelegramBotConfig struct {
+	Token       string
+	WebHookURL  string
+	SecretToken string
+	APIEndpoint string
+	PollTimeout int
+	OnError     func(err error)
+}
+
+type TelegramBot struct {
+	config     *TelegramBotConfig
+	updates    chan *Activity
+	lifecycle  *lifecycle
+	mu         sync.Mutex
+	polling    bool
+	cancelPoll context.CancelFunc
+	offset     int64
+	keyboards  map[string]map[string]string
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func NewTelegramBot(config *TelegramBotConfig) *TelegramBot {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = telegramAPI
+	}
+
+	if config.PollTimeout == 0 {
+		config.PollTimeout = 30
+	}
+
+	return &TelegramBot{
+		config:     config,
+		updates:    make(chan *Activity),
+		lifecycle:  newLifecycle(),
+		keyboards:  make(map[string]map[string]string),
+		minBackoff: telegramPollMinBackoff,
+		maxBackoff: telegramPollMaxBackoff,
+	}
+}
+
+func (b *TelegramBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	if b.config.SecretToken != "" && r.Header.Get("X-Telegram-Bot-Api-Secret-Token") != b.config.SecretToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+	defer r.Body.Close()
+	update := &telegramUpdate{}
+	err := json.NewDecoder(r.Body).Decode(update)
+
+	if err != nil {
+		errorResponse(w, "invalid update")
+		return
+	}
+
+	if activity := b.updateToActivity(update); activity != nil {
+		if !b.lifecycle.deliver(b.updates, activity) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *TelegramBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.GetUpdatesChannelContext(context.Background())
+}
+
+func (b *TelegramBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	if b.config.WebHookURL != "" {
+		payload := map[string]string{"url": b.config.WebHookURL}
+
+		if b.config.SecretToken != "" {
+			payload["secret_token"] = b.config.SecretToken
+		}
+
+		err := b.call(ctx, "setWebhook", payload, nil)
+
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := b.call(ctx, "deleteWebhook", map[string]string{}, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		b.startPolling(ctx)
+	}
+
+	return forwardUpdates(ctx, b.updates), nil
+}
+
+func (b *TelegramBot) startPolling(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.polling {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	b.polling = true
+	b.cancelPoll = cancel
+	go b.poll(ctx)
+}
+
+func (b *TelegramBot) poll(ctx context.Context) {
+	defer func() {
+		b.mu.Lock()
+		b.polling = false
+		b.cancelPoll()
+		b.mu.Unlock()
+	}()
+
+	backoff := b.minBackoff
+
+	for ctx.Err() == nil {
+		if !b.lifecycle.enter() {
+			return
+		}
+
+		err := b.pollOnce(ctx)
+		b.lifecycle.leave()
+
+		if err == nil || ctx.Err() != nil {
+			backoff = b.minBackoff
+			continue
+		}
+
+		if b.config.OnError != nil {
+			b.config.OnError(err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+
+		backoff *= 2
+
+		if backoff > b.maxBackoff {
+			backoff = b.maxBackoff
+		}
+	}
+}
+
+func (b *TelegramBot) pollOnce(ctx context.Context) error {
+	var updates []*telegramUpdate
+
+	err := b.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":  b.offset,
+		"timeout": b.config.PollTimeout,
+	}, &updates)
+
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		if activity := b.updateToActivity(update); activity != nil {
+			if !b.lifecycle.deliver(b.updates, activity) {
+				return nil
+			}
+		}
+
+		b.offset = update.UpdateId + 1
+	}
+
+	return nil
+}
+
+func (b *TelegramBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *TelegramBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	chatId := targetConversationId(activity)
+
+	if activity.Type == TypeTyping {
+		return nil, b.call(ctx, "sendChatAction", map[string]interface{}{"chat_id": chatId, "action": "typing"}, nil)
+	}
+
+	text := activity.Text
+	var markup interface{}
+	var keyboard map[string]string
+	var photo string
+
+	for _, a := range activity.Attachments {
+		if a.ContentType == TypeHeroCard {
+			if card, ok := a.Content.(*HeroCard); ok {
+				text = joinText(card.Title, card.Text, text)
+				markup = telegramInlineKeyboard(card.Buttons)
+
+				if len(card.Images) > 0 {
+					photo = card.Images[0].Url
+				}
+			}
+		} else if strings.HasPrefix(a.ContentType, "image") && photo == "" {
+			photo = a.ContentUrl
+		}
+	}
+
+	if activity.SuggestedActions != nil && len(activity.SuggestedActions.Actions) > 0 {
+		markup = telegramReplyKeyboard(activity.SuggestedActions.Actions)
+		keyboard = telegramKeyboardValues(activity.SuggestedActions.Actions)
+	}
+
+	message := map[string]interface{}{"chat_id": chatId}
+
+	if mode := telegramParseMode(activity.TextFormat); mode != "" {
+		message["parse_mode"] = mode
+	}
+
+	if markup != nil {
+		message["reply_markup"] = markup
+	}
+
+	method := "sendMessage"
+
+	if photo != "" {
+		method = "sendPhoto"
+		message["photo"] = photo
+		message["caption"] = text
+	} else {
+		message["text"] = text
+	}
+
+	result := &telegramMessage{}
+	err := b.call(ctx, method, message, result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+
+	if keyboard != nil {
+		b.keyboards[chatId] = keyboard
+	} else {
+		delete(b.keyboards, chatId)
+	}
+
+	b.mu.Unlock()
+
+	return &Identification{Id: strconv.FormatInt(result.MessageId, 10)}, nil
+}
+
+func (b *TelegramBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *TelegramBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	messageId, err := strconv.ParseInt(activity.Id, 10, 64)
+
+	if err != nil {
+		return nil, errors.New("invalid telegram message id: " + activity.Id)
+	}
+
+	message := map[string]interface{}{
+		"chat_id":    targetConversationId(activity),
+		"message_id": messageId,
+		"text":       activity.Text,
+	}
+
+	if mode := telegramParseMode(activity.TextFormat); mode != "" {
+		message["parse_mode"] = mode
+	}
+
+	for _, a := range activity.Attachments {
+		if card, ok := a.Content.(*HeroCard); ok && a.ContentType == TypeHeroCard {
+			message["text"] = joinText(card.Title, card.Text, activity.Text)
+			message["reply_markup"] = telegramInlineKeyboard(card.Buttons)
+		}
+	}
+
+	err = b.call(ctx, "editMessageText", message, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identification{Id: activity.Id}, nil
+}
+
+func (b *TelegramBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *TelegramBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	messageId, err := strconv.ParseInt(activity.Id, 10, 64)
+
+	if err != nil {
+		return errors.New("invalid telegram message id: " + activity.Id)
+	}
+
+	return b.call(ctx, "deleteMessage", map[string]interface{}{
+		"chat_id":    targetConversationId(activity),
+		"message_id": messageId,
+	}, nil)
+}
+
+func (b *TelegramBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *TelegramBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	fileUrl := attachment.ContentUrl
+
+	if !strings.HasPrefix(fileUrl, "http://") && !strings.HasPrefix(fileUrl, "https://") {
+		var file struct {
+			FilePath string `json:"file_path"`
+		}
+
+		err := b.call(ctx, "getFile", map[string]string{"file_id": attachment.ContentUrl}, &file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fileUrl = b.config.APIEndpoint + "/file/bot" + b.config.Token + "/" + file.FilePath
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fileUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func (b *TelegramBot) GetChannels() []string {
+	return telegramChannels
+}
+
+func (b *TelegramBot) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+
+	if b.cancelPoll != nil {
+		b.cancelPoll()
+	}
+
+	b.mu.Unlock()
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *TelegramBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *TelegramBot) call(ctx context.Context, method string, payload interface{}, result interface{}) error {
+	request := gorequest.New().Post(b.config.APIEndpoint + "/bot" + b.config.Token + "/" + method).Send(payload)
+	resp, body, err := endRequest(ctx, request)
+
+	if err != nil {
+		return err
+	}
+
+	var response struct {
+		Ok          bool            `json:"ok"`
+		Description string          `json:"description"`
+		ErrorCode   int             `json:"error_code"`
+		Result      json.RawMessage `json:"result"`
+	}
+
+	err = json.Unmarshal(body, &response)
+
+	if err != nil {
+		return errors.New(fmt.Sprintf("telegram %s failed: %s %d", method, body, resp.StatusCode))
+	}
+
+	if !response.Ok {
+		return errors.New(fmt.Sprintf("telegram %s failed: %s %d", method, response.Description, response.ErrorCode))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+func (b *TelegramBot) updateToActivity(update *telegramUpdate) *Activity {
+	switch {
+	case update.Message != nil:
+		result := telegramToActivity(update.Message)
+		b.applyKeyboard(result)
+		return result
+	case update.EditedMessage != nil:
+		return telegramToActivity(update.EditedMessage)
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		query := update.CallbackQuery
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			b.call(ctx, "answerCallbackQuery", map[string]string{"callback_query_id": query.Id}, nil)
+		}()
+
+		result := telegramToActivity(query.Message)
+		result.Type = TypeMessage
+		result.From = query.From.account()
+		result.Text = query.Data
+		result.Attachments = nil
+		return result
+	}
+
+	return nil
+}
+
+func (b *TelegramBot) applyKeyboard(activity *Activity) {
+	if activity.Conversation == nil || activity.Text == "" {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	keyboard := b.keyboards[activity.Conversation.Id]
+
+	if value, ok := keyboard[activity.Text]; ok {
+		activity.Text = value
+		delete(b.keyboards, activity.Conversation.Id)
+	}
+}
+
+type telegramUpdate struct {
+	UpdateId      int64                  `json:"update_id"`
+	Message       *telegramMessage       `json:"message"`
+	EditedMessage *telegramMessage       `json:"edited_message"`
+	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
+}
+
+type telegramUser struct {
+	Id        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+func (u *telegramUser) account() *ChannelAccount {
+	if u == nil {
+		return nil
+	}
+
+	return &ChannelAccount{
+		Identification: Identification{Id: strconv.FormatInt(u.Id, 10)},
+		Name:           strings.TrimSpace(u.FirstName + " " + u.LastName),
+	}
+}
+
+type telegramChat struct {
+	Id        int64  `json:"id"`
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type telegramFile struct {
+	FileId   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+}
+
+type telegramLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type telegramMessage struct {
+	MessageId      int64             `json:"message_id"`
+	From           *telegramUser     `json:"from"`
+	Chat           *telegramChat     `json:"chat"`
+	Date           int64             `json:"date"`
+	Text           string            `json:"text"`
+	Caption        string            `json:"caption"`
+	Photo          []*telegramFile   `json:"photo"`
+	Document       *telegramFile     `json:"document"`
+	Audio          *telegramFile     `json:"audio"`
+	Video          *telegramFile     `json:"video"`
+	Voice          *telegramFile     `json:"voice"`
+	Sticker        *telegramFile     `json:"sticker"`
+	Location       *telegramLocation `json:"location"`
+	NewChatMembers []*telegramUser   `json:"new_chat_members"`
+	LeftChatMember *telegramUser     `json:"left_chat_member"`
+}
+
+type telegramCallbackQuery struct {
+	Id      string           `json:"id"`
+	From    *telegramUser    `json:"from"`
+	Message *telegramMessage `json:"message"`
+	Data    string           `json:"data"`
+}
+
+type telegramButton struct {
+	Text         string `json:"text"`
+	Url          string `json:"url,omitempty"`
+	CallbackData string `json:"callback_data,omitempty"`
+}
+
+func telegramToActivity(m *telegramMessage) *Activity {
+	result := &Activity{}
+	result.Id = strconv.FormatInt(m.MessageId, 10)
+	result.ChannelId = ChannelTelegram
+	result.Type = TypeMessage
+	result.Text = m.Text
+	result.From = m.From.account()
+
+	if m.Chat != nil {
+		name := m.Chat.Title
+
+		if name == "" {
+			name = strings.TrimSpace(m.Chat.FirstName + " " + m.Chat.LastName)
+		}
+
+		result.Conversation = &ConversationAccount{
+			ChannelAccount: ChannelAccount{
+				Identification: Identification{Id: strconv.FormatInt(m.Chat.Id, 10)},
+				Name:           name,
+			},
+			IsGroup: m.Chat.Type != "private",
+		}
+	}
+
+	if result.Text == "" {
+		result.Text = m.Caption
+	}
+
+	if len(m.Photo) > 0 {
+		photo := m.Photo[len(m.Photo)-1]
+		result.Attachments = append(result.Attachments, &Attachment{ContentType: "image/jpeg", ContentUrl: photo.FileId})
+	}
+
+	for _, f := range []*telegramFile{m.Document, m.Audio, m.Video, m.Voice, m.Sticker} {
+		if f != nil {
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: f.MimeType,
+				ContentUrl:  f.FileId,
+				Name:        f.FileName,
+			})
+		}
+	}
+
+	if m.Location != nil {
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType: TypeGeoCoordinates,
+			Content: &GeoCoordinates{
+				Latitude:  m.Location.Latitude,
+				Longitude: m.Location.Longitude,
+			},
+		})
+	}
+
+	if len(m.NewChatMembers) > 0 || m.LeftChatMember != nil {
+		result.Type = TypeConversationUpdate
+
+		for _, u := range m.NewChatMembers {
+			result.MembersAdded = append(result.MembersAdded, u.account())
+		}
+
+		if m.LeftChatMember != nil {
+			result.MembersRemoved = append(result.MembersRemoved, m.LeftChatMember.account())
+		}
+	}
+
+	return result
+}
+
+func telegramParseMode(format TextFormat) string {
+	switch format {
+	case Markdown:
+		return "Markdown"
+	case Xml:
+		return "HTML"
+	}
+
+	return ""
+}
+
+func telegramInlineKeyboard(actions []*CardAction) interface{} {
+	keyboard := make([][]telegramButton, 0)
+
+	for _, action := range actions {
+		button := telegramButton{Text: action.Title}
+
+		if action.Type == TypeOpenUrl {
+			button.Url = action.Value
+		} else {
+			button.CallbackData = action.Value
+		}
+
+		keyboard = append(keyboard, []telegramButton{button})
+	}
+
+	return map[string]interface{}{"inline_keyboard": keyboard}
+}
+
+func telegramReplyKeyboard(actions []*CardAction) interface{} {
+	keyboard := make([][]telegramButton, 0)
+
+	for _, action := range actions {
+		keyboard = append(keyboard, []telegramButton{{Text: action.Title}})
+	}
+
+	return map[string]interface{}{
+		"keyboard":          keyboard,
+		"one_time_keyboard": true,
+		"resize_keyboard":   true,
+	}
+}
+
+func telegramKeyboardValues(actions []*CardAction) map[string]string {
+	result := make(map[string]string)
+
+	for _, action := range actions {
+		if action.Value != "" {
+			result[action.Title] = action.Value
+		}
+	}
+
+	return result
+}
+
+func joinText(parts ...string) string {
+	result := make([]string, 0, len(parts))
+
+	for _, p := range parts {
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+
+	return strings.Join(result, "\n")
+}
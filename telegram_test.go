@@ -0,0 +1,216 @@
+package bots
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTelegramSecretToken(t *testing.T) {
+	body := `{"update_id":1,"message":{"message_id":1,"from":{"id":10},"chat":{"id":20,"type":"private"},"text":"hi"}}`
+
+	tests := []struct {
+		name   string
+		secret string
+		status int
+	}{
+		{"valid", "secret", http.StatusOK},
+		{"wrong secret", "other", http.StatusUnauthorized},
+		{"missing secret", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewTelegramBot(&TelegramBotConfig{SecretToken: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(body))
+
+			if tt.secret != "" {
+				r.Header.Set("X-Telegram-Bot-Api-Secret-Token", tt.secret)
+			}
+
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if tt.status == http.StatusOK && (activity == nil || activity.Text != "hi" || activity.Conversation.Id != "20") {
+				t.Fatalf("unexpected activity %+v", activity)
+			} else if tt.status != http.StatusOK && activity != nil {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+		})
+	}
+}
+
+func TestTelegramLocation(t *testing.T) {
+	activity := telegramToActivity(&telegramMessage{
+		MessageId: 1,
+		From:      &telegramUser{Id: 10},
+		Chat:      &telegramChat{Id: 20, Type: "private"},
+		Location:  &telegramLocation{Latitude: 1.5, Longitude: 2.5},
+	})
+
+	if activity.Text != "" || len(activity.Attachments) != 1 || activity.Attachments[0].ContentType != TypeGeoCoordinates {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	geo, ok := activity.Attachments[0].Content.(*GeoCoordinates)
+
+	if !ok || geo.Latitude != 1.5 || geo.Longitude != 2.5 {
+		t.Fatalf("unexpected coordinates %+v", activity.Attachments[0].Content)
+	}
+}
+
+func TestTelegramReplyKeyboardValue(t *testing.T) {
+	bot := NewTelegramBot(&TelegramBotConfig{})
+	bot.keyboards["20"] = telegramKeyboardValues([]*CardAction{
+		{Type: TypeImBack, Title: "Yes", Value: "confirm"},
+		{Type: TypeImBack, Title: "No", Value: "cancel"},
+	})
+
+	message := `{"message_id":1,"from":{"id":10},"chat":{"id":20,"type":"private"},"text":"Yes"}`
+	update := &telegramUpdate{}
+
+	if err := json.Unmarshal([]byte(`{"update_id":1,"message":`+message+`}`), update); err != nil {
+		t.Fatal(err)
+	}
+
+	if activity := bot.updateToActivity(update); activity.Text != "confirm" {
+		t.Fatalf("text = %q, want %q", activity.Text, "confirm")
+	}
+
+	if activity := bot.updateToActivity(update); activity.Text != "Yes" {
+		t.Fatalf("keyboard was not cleared after use, text = %q", activity.Text)
+	}
+}
+
+func TestTelegramPollBackoff(t *testing.T) {
+	const failures = 4
+	var mu sync.Mutex
+	var polls []time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/getUpdates") {
+			w.Write([]byte(`{"ok":true,"result":true}`))
+			return
+		}
+
+		mu.Lock()
+		polls = append(polls, time.Now())
+		n := len(polls)
+		mu.Unlock()
+
+		switch {
+		case n <= failures:
+			w.Write([]byte(`{"ok":false,"error_code":502,"description":"Bad Gateway"}`))
+		case n == failures+1:
+			w.Write([]byte(`{"ok":true,"result":[{"update_id":7,"message":{"message_id":1,"from":{"id":10},"chat":{"id":20,"type":"private"},"text":"hi"}}]}`))
+		default:
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	errs := make(chan error, failures)
+	bot := NewTelegramBot(&TelegramBotConfig{
+		APIEndpoint: server.URL,
+		OnError:     func(err error) { errs <- err },
+	})
+	bot.minBackoff = 20 * time.Millisecond
+	bot.maxBackoff = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := bot.GetUpdatesChannelContext(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case activity := <-updates:
+		if activity.Text != "hi" {
+			t.Fatalf("unexpected activity %+v", activity)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no activity delivered")
+	}
+
+	if len(errs) != failures {
+		t.Fatalf("OnError called %d times, want %d", len(errs), failures)
+	}
+
+	if err := <-errs; !strings.Contains(err.Error(), "Bad Gateway") {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+
+	for i, min := range want {
+		if gap := polls[i+1].Sub(polls[i]); gap < min {
+			t.Errorf("poll %d came %v after the failure, want at least %v", i+1, gap, min)
+		}
+	}
+}
+
+func TestTelegramKeyboardClearedByNextMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"result":{"message_id":5}}`))
+	}))
+	defer server.Close()
+
+	bot := NewTelegramBot(&TelegramBotConfig{APIEndpoint: server.URL})
+	to := func(chat string) *Activity {
+		return &Activity{Type: TypeMessage, Text: "question", Conversation: &ConversationAccount{ChannelAccount: ChannelAccount{Identification: Identification{Id: chat}}}}
+	}
+
+	question := to("20")
+	question.SuggestedActions = &SuggestedActions{Actions: []*CardAction{{Type: TypeImBack, Title: "Yes", Value: "confirm"}}}
+	other := to("30")
+	other.SuggestedActions = question.SuggestedActions
+
+	for _, activity := range []*Activity{question, other} {
+		if _, err := bot.Send(activity); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(bot.keyboards) != 2 {
+		t.Fatalf("keyboards = %v, want two chats", bot.keyboards)
+	}
+
+	typing := to("20")
+	typing.Type = TypeTyping
+
+	if _, err := bot.Send(typing); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := bot.keyboards["20"]; !ok {
+		t.Fatal("typing indicator cleared the keyboard")
+	}
+
+	if _, err := bot.Send(to("20")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := bot.keyboards["20"]; ok {
+		t.Fatal("keyboard was not cleared by the next message")
+	}
+
+	if _, ok := bot.keyboards["30"]; !ok {
+		t.Fatal("keyboard of another chat was cleared")
+	}
+}
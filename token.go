@@ -0,0 +1,286 @@
+package bots
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/parnurzeal/gorequest"
+)
+
+const (
+	tokenRefreshWindow  = 5 * time.Minute
+	tokenExpiryLeeway   = 30 * time.Second
+	tokenRefreshTimeout = 30 * time.Second
+)
+
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+func StaticTokenSource(accessToken string) TokenSource {
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return &Token{AccessToken: accessToken}, nil
+	})
+}
+
+type ClientCredentials struct {
+	TokenURL     string
+	ClientId     string
+	ClientSecret string
+	Scope        string
+}
+
+func (c *ClientCredentials) Token(ctx context.Context) (*Token, error) {
+	r := gorequest.New().Post(c.TokenURL)
+	r.Type("multipart")
+	r.Set("User-Agent", UserAgent)
+	r.Send(map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     c.ClientId,
+		"client_secret": c.ClientSecret,
+		"scope":         c.Scope,
+	})
+
+	return requestToken(ctx, r)
+}
+
+type CertificateCredentials struct {
+	TokenURL    string
+	ClientId    string
+	Certificate *x509.Certificate
+	PrivateKey  *rsa.PrivateKey
+	Scope       string
+}
+
+func (c *CertificateCredentials) Token(ctx context.Context) (*Token, error) {
+	assertion, err := c.assertion()
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := gorequest.New().Post(c.TokenURL)
+	r.Type("form")
+	r.Set("User-Agent", UserAgent)
+	r.Send(map[string]string{
+		"grant_type":            "client_credentials",
+		"client_id":             c.ClientId,
+		"client_assertion_type": "urn:ietf:params:oauth:client-assertion-type:jwt-bearer",
+		"client_assertion":      assertion,
+		"scope":                 c.Scope,
+	})
+
+	return requestToken(ctx, r)
+}
+
+func (c *CertificateCredentials) assertion() (string, error) {
+	if c.Certificate == nil || c.PrivateKey == nil {
+		return "", errors.New("certificate credentials require a certificate and a private key")
+	}
+
+	jti := make([]byte, 16)
+
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	thumbprint := sha1.Sum(c.Certificate.Raw)
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"aud": c.TokenURL,
+		"iss": c.ClientId,
+		"sub": c.ClientId,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	})
+	token.Header["x5t"] = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	return token.SignedString(c.PrivateKey)
+}
+
+func requestToken(ctx context.Context, r *gorequest.SuperAgent) (*Token, error) {
+	issued := time.Now()
+	resp, body, err := endRequest(ctx, r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, errors.New(fmt.Sprintf("Refresh access token failed with status code: %d", resp.StatusCode))
+	}
+
+	oauthResponse := OAuthResponse{}
+	err = json.Unmarshal(body, &oauthResponse)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken: oauthResponse.AccessToken,
+		Expiry:      issued.Add(time.Duration(oauthResponse.ExpiresIn) * time.Second),
+	}, nil
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+type tokenManager struct {
+	source    TokenSource
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	token     *Token
+	refreshAt time.Time
+	call      *tokenCall
+	timer     *time.Timer
+}
+
+func newTokenManager(source TokenSource) *tokenManager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &tokenManager{source: source, ctx: ctx, cancel: cancel}
+}
+
+func (m *tokenManager) Token(ctx context.Context) (*Token, error) {
+	m.mu.Lock()
+	now := time.Now()
+
+	if m.token != nil && usable(m.token, now) {
+		token := m.token
+
+		if !m.refreshAt.IsZero() && !now.Before(m.refreshAt) {
+			m.refresh()
+		}
+
+		m.mu.Unlock()
+		return token, nil
+	}
+
+	call := m.refresh()
+	m.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (m *tokenManager) invalidate(token *Token) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.token == token {
+		m.token = nil
+	}
+}
+
+func (m *tokenManager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancel()
+
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+}
+
+func (m *tokenManager) refresh() *tokenCall {
+	if m.call != nil {
+		return m.call
+	}
+
+	call := &tokenCall{done: make(chan struct{})}
+	m.call = call
+
+	go func() {
+		ctx, cancel := context.WithTimeout(m.ctx, tokenRefreshTimeout)
+		defer cancel()
+		token, err := m.source.Token(ctx)
+
+		if err == nil && token == nil {
+			err = errors.New("token source returned no token")
+		}
+
+		m.mu.Lock()
+
+		if err == nil {
+			m.store(token)
+		}
+
+		m.call = nil
+		m.mu.Unlock()
+
+		call.token, call.err = token, err
+		close(call.done)
+	}()
+
+	return call
+}
+
+func (m *tokenManager) store(token *Token) {
+	m.token = token
+
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+
+	if token.Expiry.IsZero() || !usable(token, time.Now()) {
+		m.refreshAt = time.Time{}
+		return
+	}
+
+	window := tokenRefreshWindow
+
+	if lifetime := time.Until(token.Expiry); lifetime < 2*window {
+		window = lifetime / 2
+	}
+
+	m.refreshAt = token.Expiry.Add(-window)
+
+	if m.ctx.Err() == nil {
+		m.timer = time.AfterFunc(time.Until(m.refreshAt), m.renew)
+	}
+}
+
+func (m *tokenManager) renew() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx.Err() == nil {
+		m.refresh()
+	}
+}
+
+func usable(token *Token, now time.Time) bool {
+	return token.Expiry.IsZero() || now.Before(token.Expiry.Add(-tokenExpiryLeeway))
+}
@@ -0,0 +1,199 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingSource struct {
+	calls   int32
+	release chan struct{}
+	expiry  time.Duration
+	err     error
+}
+
+func (s *countingSource) Token(ctx context.Context) (*Token, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+
+	if s.release != nil {
+		<-s.release
+	}
+
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	token := &Token{AccessToken: "token-" + strconv.Itoa(int(n))}
+
+	if s.expiry != 0 {
+		token.Expiry = time.Now().Add(s.expiry)
+	}
+
+	return token, nil
+}
+
+func (s *countingSource) count() int {
+	return int(atomic.LoadInt32(&s.calls))
+}
+
+func TestTokenManagerSingleFlight(t *testing.T) {
+	source := &countingSource{release: make(chan struct{}), expiry: time.Hour}
+	m := newTokenManager(source)
+	defer m.stop()
+	wg := sync.WaitGroup{}
+	tokens := make([]*Token, 10)
+
+	for i := range tokens {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], _ = m.Token(context.Background())
+		}(i)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(source.release)
+	wg.Wait()
+
+	if source.count() != 1 {
+		t.Fatalf("source called %d times, want 1", source.count())
+	}
+
+	for _, token := range tokens {
+		if token == nil || token.AccessToken != "token-1" {
+			t.Fatalf("unexpected token %+v", token)
+		}
+	}
+}
+
+func TestTokenManagerExpiry(t *testing.T) {
+	tests := []struct {
+		name   string
+		expiry time.Duration
+		calls  int
+	}{
+		{"no expiry", 0, 1},
+		{"valid", time.Hour, 1},
+		{"within leeway", tokenExpiryLeeway / 2, 3},
+		{"expired", -time.Minute, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &countingSource{expiry: tt.expiry}
+			m := newTokenManager(source)
+			defer m.stop()
+
+			for i := 0; i < 3; i++ {
+				if _, err := m.Token(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if source.count() != tt.calls {
+				t.Fatalf("source called %d times, want %d", source.count(), tt.calls)
+			}
+		})
+	}
+}
+
+func TestTokenManagerRefreshWindow(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		window   time.Duration
+	}{
+		{"long lived", time.Hour, tokenRefreshWindow},
+		{"short lived", 4 * time.Minute, 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTokenManager(&countingSource{})
+			defer m.stop()
+			token := &Token{AccessToken: "a", Expiry: time.Now().Add(tt.lifetime)}
+			m.mu.Lock()
+			m.store(token)
+			refreshAt := m.refreshAt
+			m.mu.Unlock()
+
+			if d := token.Expiry.Sub(refreshAt) - tt.window; d < -time.Second || d > time.Second {
+				t.Fatalf("refresh %v before expiry, want %v", token.Expiry.Sub(refreshAt), tt.window)
+			}
+		})
+	}
+}
+
+func TestTokenManagerProactiveRenewal(t *testing.T) {
+	source := &countingSource{expiry: time.Hour}
+	m := newTokenManager(source)
+	defer m.stop()
+	first, _ := m.Token(context.Background())
+	m.mu.Lock()
+	m.refreshAt = time.Now().Add(-time.Second)
+	m.mu.Unlock()
+	cached, _ := m.Token(context.Background())
+
+	if cached != first {
+		t.Fatalf("token inside the refresh window was not served from cache")
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for source.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if source.count() != 2 {
+		t.Fatalf("source called %d times, want a background renewal", source.count())
+	}
+
+	if renewed, _ := m.Token(context.Background()); renewed.AccessToken != "token-2" {
+		t.Fatalf("got %q after renewal, want token-2", renewed.AccessToken)
+	}
+}
+
+func TestTokenManagerInvalidate(t *testing.T) {
+	source := &countingSource{expiry: time.Hour}
+	m := newTokenManager(source)
+	defer m.stop()
+	first, _ := m.Token(context.Background())
+	m.invalidate(&Token{AccessToken: "stale"})
+
+	if token, _ := m.Token(context.Background()); token != first {
+		t.Fatalf("invalidating another token dropped the current one")
+	}
+
+	m.invalidate(first)
+	token, _ := m.Token(context.Background())
+
+	if token.AccessToken != "token-2" || source.count() != 2 {
+		t.Fatalf("got %q after %d calls, want token-2 after 2", token.AccessToken, source.count())
+	}
+}
+
+func TestTokenManagerError(t *testing.T) {
+	source := &countingSource{err: errors.New("boom")}
+	m := newTokenManager(source)
+	defer m.stop()
+
+	if _, err := m.Token(context.Background()); err == nil || err.Error() != "boom" {
+		t.Fatalf("err = %v, want boom", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source.err = nil
+	source.release = make(chan struct{})
+	defer close(source.release)
+
+	if _, err := m.Token(ctx); err != context.Canceled {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -1,135 +1,586 @@
 package bots
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/nickalie/viber"
+	"github.com/parnurzeal/gorequest"
+	"io/ioutil"
+	"mime"
 	"net/http"
-	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	viberAPI           = "https://chatapi.viber.com/pa"
+	viberBroadcastMax  = 300
+	viberDefaultSender = "Bot"
+
+	viberTooManyRequests = 12
+)
+
 var viberChannels = []string{ChannelViber}
 
 type ViberBot struct {
-	bot     *viber.Viber
-	updates chan *Activity
-	config  *ViberBotConfig
+	bot       *viber.Viber
+	updates   chan *Activity
+	config    *ViberBotConfig
+	lifecycle *lifecycle
+	limiter   *rateLimiter
 }
 
 type ViberBotConfig struct {
-	Token               string
-	WebHookURL          string
-	ConversationStarted func(m *Activity) *Activity
+	Token                   string
+	WebHookURL              string
+	APIEndpoint             string
+	SenderName              string
+	SenderAvatar            string
+	ConversationStarted     func(m *Activity) *Activity
+	SkipSignatureValidation bool
+	RateLimit               *RateLimit
+	ConversationRateLimit   *RateLimit
+	Retry                   *RetryPolicy
+}
+
+type ViberUser struct {
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	Avatar          string `json:"avatar"`
+	Country         string `json:"country"`
+	Language        string `json:"language"`
+	PrimaryDeviceOs string `json:"primary_device_os"`
+	ApiVersion      int    `json:"api_version"`
+	ViberVersion    string `json:"viber_version"`
+	DeviceType      string `json:"device_type"`
 }
 
 func NewViberBot(config *ViberBotConfig) (*ViberBot, error) {
-	result := &ViberBot{updates: make(chan *Activity), config: config}
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = viberAPI
+	}
+
+	if config.Retry == nil {
+		config.Retry = defaultRetryPolicy()
+	}
+
+	if config.SenderName == "" {
+		config.SenderName = viberDefaultSender
+	}
+
+	result := &ViberBot{
+		updates:   make(chan *Activity),
+		config:    config,
+		lifecycle: newLifecycle(),
+		limiter:   newRateLimiter(config.RateLimit, config.ConversationRateLimit),
+	}
+
 	result.bot = &viber.Viber{
 		AppKey: config.Token,
 		Sender: viber.Sender{
-			Name: "To Kindle Bot",
+			Name:   config.SenderName,
+			Avatar: config.SenderAvatar,
 		},
-		Message: result.messageHandler,
 	}
 
-	if config.ConversationStarted != nil {
-		result.bot.ConversationStarted = result.conversationStartedHandler
-	}
+	return result, nil
+}
+
+func (b *ViberBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	err := b.SetWebhook(context.Background())
+	return b.updates, err
+}
 
-	go func() {
-		_, err := result.bot.SetWebhook(config.WebHookURL, nil)
+func (b *ViberBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	err := b.SetWebhook(ctx)
 
-		if err != nil {
-			fmt.Printf("unabled to set viber webhook: %v\n", err)
-			os.Exit(1)
-		}
-	}()
+	if err != nil {
+		return nil, err
+	}
 
-	return result, nil
+	return forwardUpdates(ctx, b.updates), nil
 }
 
-func (b *ViberBot) conversationStartedHandler(v *viber.Viber, u viber.User, conversationType, context string, subscribed bool, token uint64, t time.Time) viber.Message {
-	m := b.config.ConversationStarted(viberToActivity(b.bot.NewTextMessage(""), &u))
-	return b.activityToViber(m)
+func (b *ViberBot) SetWebhook(ctx context.Context) error {
+	return b.post(ctx, "set_webhook", map[string]string{"url": b.config.WebHookURL}, nil)
 }
 
-func (b *ViberBot) messageHandler(v *viber.Viber, u viber.User, m viber.Message, token uint64, t time.Time) {
-	switch v := m.(type) {
-	case *viber.TextMessage:
-		b.updates <- viberToActivity(v, &u)
-	case *viber.FileMessage:
-		m := viberToActivity(&v.TextMessage, &u)
-		a := &Attachment{
-			Name:       v.FileName,
-			ContentUrl: v.Media,
-		}
-		m.Attachments = append(m.Attachments, a)
+func (b *ViberBot) GetUserDetails(ctx context.Context, id string) (*ViberUser, error) {
+	var result struct {
+		User *ViberUser `json:"user"`
+	}
+
+	err := b.post(ctx, "get_user_details", map[string]string{"id": id}, &result)
 
-		b.updates <- m
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (b *ViberBot) GetUpdatesChannel() (<-chan *Activity, error) {
-	_, err := b.bot.SetWebhook(b.config.WebHookURL, nil)
-	return b.updates, err
+	return result.User, nil
 }
 
 func (b *ViberBot) Send(a *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), a)
+}
+
+func (b *ViberBot) SendContext(ctx context.Context, a *Activity) (*Identification, error) {
+	receiver := targetUserId(a)
+
+	if receiver == "" {
+		return nil, errors.New("viber: activity has no recipient")
+	}
+
 	m := b.activityToViber(a)
-	token, err := b.bot.SendMessage(a.Recipient.Id, m)
+	m.SetReceiver(receiver)
+	var result struct {
+		MessageToken uint64 `json:"message_token"`
+	}
+
+	err := b.postTo(ctx, "send_message", receiver, m, &result)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identification{Id: strconv.FormatUint(result.MessageToken, 10)}, nil
+}
+
+func (b *ViberBot) Broadcast(references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error) {
+	return b.BroadcastContext(context.Background(), references, activity, options)
+}
+
+func (b *ViberBot) BroadcastContext(ctx context.Context, references []*ConversationReference, activity *Activity, options *BroadcastOptions) (*BroadcastReport, error) {
+	report := &BroadcastReport{Results: make([]*BroadcastResult, len(references))}
+	var receivers []int
+
+	for i, reference := range references {
+		if err := validReference(reference); err != nil {
+			report.Results[i] = &BroadcastResult{Reference: reference, Err: err}
+		} else if reference.recipientId() == "" {
+			report.Results[i] = &BroadcastResult{Reference: reference, Err: errors.New("conversation reference has no user")}
+		} else {
+			receivers = append(receivers, i)
+		}
+	}
+
+	payload, err := b.broadcastPayload(activity)
 
 	if err != nil {
 		return nil, err
-	} else {
-		return &Identification{Id: strconv.FormatUint(token, 10)}, nil
+	}
+
+	chunks := (len(receivers) + viberBroadcastMax - 1) / viberBroadcastMax
+
+	fanOut(chunks, options, func(chunk int) {
+		end := (chunk + 1) * viberBroadcastMax
+
+		if end > len(receivers) {
+			end = len(receivers)
+		}
+
+		b.broadcastChunk(ctx, payload, references, receivers[chunk*viberBroadcastMax:end], report)
+	})
+
+	return report, nil
+}
+
+func (b *ViberBot) broadcastPayload(activity *Activity) (map[string]interface{}, error) {
+	a := *activity
+	data, err := json.Marshal(b.activityToViber(&a))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	err = json.Unmarshal(data, &result)
+	delete(result, "receiver")
+	return result, err
+}
+
+func (b *ViberBot) broadcastChunk(ctx context.Context, payload map[string]interface{}, references []*ConversationReference, indexes []int, report *BroadcastReport) {
+	message := make(map[string]interface{}, len(payload)+1)
+
+	for k, v := range payload {
+		message[k] = v
+	}
+
+	list := make([]string, len(indexes))
+
+	for i, index := range indexes {
+		list[i] = references[index].recipientId()
+	}
+
+	message["broadcast_list"] = list
+
+	var result struct {
+		MessageToken uint64 `json:"message_token"`
+		FailedList   []struct {
+			Receiver      string `json:"receiver"`
+			Status        int    `json:"status"`
+			StatusMessage string `json:"status_message"`
+		} `json:"failed_list"`
+	}
+
+	err := b.post(ctx, "broadcast_message", message, &result)
+	failed := make(map[string]error)
+
+	for _, f := range result.FailedList {
+		failed[f.Receiver] = errors.New(fmt.Sprintf("viber broadcast_message failed for %s: %s %d", f.Receiver, f.StatusMessage, f.Status))
+	}
+
+	for _, index := range indexes {
+		r := &BroadcastResult{Reference: references[index], Err: err}
+
+		if r.Err == nil {
+			r.Err = failed[references[index].recipientId()]
+		}
+
+		if r.Err == nil {
+			r.Id = &Identification{Id: strconv.FormatUint(result.MessageToken, 10)}
+		}
+
+		report.Results[index] = r
 	}
 }
 
 func (b *ViberBot) Update(a *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), a)
+}
+
+func (b *ViberBot) UpdateContext(ctx context.Context, a *Activity) (*Identification, error) {
 	return nil, errors.New("update isn't implemented for viber")
 }
 
 func (b *ViberBot) Delete(a *Activity) error {
+	return b.DeleteContext(context.Background(), a)
+}
+
+func (b *ViberBot) DeleteContext(ctx context.Context, a *Activity) error {
 	return errors.New("delete isn't implemented for viber")
 }
 
 func (b *ViberBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *ViberBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
 	timeout := time.Duration(5 * time.Second)
 
 	client := http.Client{
 		Timeout: timeout,
 	}
 
-	return client.Get(attachment.ContentUrl)
+	req, err := http.NewRequest(http.MethodGet, attachment.ContentUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req.WithContext(ctx))
+}
+
+func (b *ViberBot) post(ctx context.Context, method string, payload interface{}, result interface{}) error {
+	return b.postTo(ctx, method, "", payload, result)
+}
+
+func (b *ViberBot) postTo(ctx context.Context, method string, receiver string, payload interface{}, result interface{}) error {
+	request := gorequest.New().Post(b.config.APIEndpoint+"/"+method).Set("X-Viber-Auth-Token", b.config.Token).Send(payload)
+	resp, body, err := b.config.Retry.do(ctx, func() (*http.Response, []byte, error) {
+		if err := b.limiter.wait(ctx, receiver); err != nil {
+			return nil, nil, err
+		}
+
+		return endRequest(ctx, request)
+	}, viberRetryable)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return errors.New(fmt.Sprintf("viber %s failed: %s %d", method, body, resp.StatusCode))
+	}
+
+	var status struct {
+		Status        int    `json:"status"`
+		StatusMessage string `json:"status_message"`
+	}
+
+	err = json.Unmarshal(body, &status)
+
+	if err != nil {
+		return err
+	}
+
+	if status.Status != 0 {
+		return errors.New(fmt.Sprintf("viber %s failed: %s %d", method, status.StatusMessage, status.Status))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+func viberRetryable(resp *http.Response, body []byte, err error) bool {
+	if retryableFor(http.MethodPost)(resp, body, err) {
+		return true
+	}
+
+	if err != nil {
+		return false
+	}
+
+	var status struct {
+		Status int `json:"status"`
+	}
+
+	return json.Unmarshal(body, &status) == nil && status.Status == viberTooManyRequests
 }
 
 func (b *ViberBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	b.bot.ServeHTTP(w, r)
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		errorResponse(w, "unable to read body")
+		return
+	}
+
+	if !b.config.SkipSignatureValidation && !b.validSignature(body, r.Header.Get("X-Viber-Content-Signature")) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	callback := &viberCallback{}
+
+	if err = json.Unmarshal(body, callback); err != nil {
+		errorResponse(w, "invalid payload")
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+
+	activity := b.callbackToActivity(callback)
+
+	if activity == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	activity.ChannelData = json.RawMessage(body)
+
+	if callback.Event == "conversation_started" && b.config.ConversationStarted != nil {
+		if welcome := b.config.ConversationStarted(activity); welcome != nil {
+			writeJSON(w, b.activityToViber(welcome))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !b.lifecycle.deliver(b.updates, activity) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
-func (b *ViberBot) GetChannels() []string {
-	return viberChannels
+func (b *ViberBot) validSignature(body []byte, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(b.config.Token))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return signature != "" && hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
 }
 
-func viberToActivity(m *viber.TextMessage, u *viber.User) *Activity {
+func (b *ViberBot) callbackToActivity(c *viberCallback) *Activity {
 	result := &Activity{}
 	result.ChannelId = ChannelViber
-	result.Text = m.Text
-	result.From = &ChannelAccount{
-		Identification: Identification{Id: u.ID},
-		Name:           u.Name,
+	result.Id = strconv.FormatUint(c.MessageToken, 10)
+
+	user := c.Sender
+
+	if user == nil {
+		user = c.User
 	}
-	result.Conversation = &ConversationAccount{
-		ChannelAccount: *result.From,
-		IsGroup:        false,
+
+	if user == nil && c.UserId != "" {
+		user = &viberCallbackUser{Id: c.UserId}
 	}
-	result.Type = TypeMessage
+
+	if user != nil {
+		result.From = &ChannelAccount{Identification: Identification{Id: user.Id}, Name: user.Name}
+		result.Conversation = &ConversationAccount{ChannelAccount: *result.From}
+	}
+
+	switch c.Event {
+	case "message":
+		if c.Message == nil {
+			return nil
+		}
+
+		result.Type = TypeMessage
+		viberMessageToActivity(c.Message, result)
+	case "conversation_started":
+		result.Type = TypeConversationUpdate
+		result.Name = c.Event
+		result.Value = c.Context
+
+		if result.From != nil {
+			result.MembersAdded = []*ChannelAccount{result.From}
+		}
+	case "subscribed":
+		result.Type = TypeContactRelationUpdate
+		result.Action = "add"
+	case "unsubscribed":
+		result.Type = TypeContactRelationUpdate
+		result.Action = "remove"
+	case "delivered", "seen", "failed":
+		result.Type = TypeEvent
+		result.Name = c.Event
+		result.ReplyToId = result.Id
+
+		if c.Desc != "" {
+			result.Value = c.Desc
+		}
+	default:
+		return nil
+	}
+
 	return result
 }
 
+func viberMessageToActivity(m *viberCallbackMessage, result *Activity) {
+	result.Text = m.Text
+
+	switch m.Type {
+	case "picture":
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType:  "image/jpeg",
+			ContentUrl:   m.Media,
+			ThumbnailUrl: m.Thumbnail,
+			Name:         m.FileName,
+		})
+	case "video":
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType:  "video/mp4",
+			ContentUrl:   m.Media,
+			ThumbnailUrl: m.Thumbnail,
+		})
+	case "file":
+		contentType := mime.TypeByExtension(path.Ext(m.FileName))
+
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType: contentType,
+			ContentUrl:  m.Media,
+			Name:        m.FileName,
+		})
+	case "sticker":
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType: "image/png",
+			ContentUrl:  m.Media,
+			Name:        "sticker-" + strconv.Itoa(m.StickerId),
+		})
+	case "location":
+		if m.Location != nil {
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: TypeGeoCoordinates,
+				Content: &GeoCoordinates{
+					Latitude:  m.Location.Lat,
+					Longitude: m.Location.Lon,
+					Address:   m.Location.Address,
+				},
+			})
+		}
+	case "contact":
+		if m.Contact != nil {
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: "text/vcard",
+				Name:        m.Contact.Name,
+				Content:     fmt.Sprintf("BEGIN:VCARD\nVERSION:3.0\nFN:%s\nTEL:%s\nEND:VCARD", m.Contact.Name, m.Contact.PhoneNumber),
+			})
+		}
+	case "url":
+		result.Text = m.Media
+	}
+}
+
+type viberCallbackUser struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Avatar   string `json:"avatar"`
+	Country  string `json:"country"`
+	Language string `json:"language"`
+}
+
+type viberCallbackMessage struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	Media     string `json:"media"`
+	Thumbnail string `json:"thumbnail"`
+	FileName  string `json:"file_name"`
+	StickerId int    `json:"sticker_id"`
+	Location  *struct {
+		Lat     float64 `json:"lat"`
+		Lon     float64 `json:"lon"`
+		Address string  `json:"address"`
+	} `json:"location"`
+	Contact *struct {
+		Name        string `json:"name"`
+		PhoneNumber string `json:"phone_number"`
+	} `json:"contact"`
+}
+
+type viberCallback struct {
+	Event        string                `json:"event"`
+	MessageToken uint64                `json:"message_token"`
+	UserId       string                `json:"user_id"`
+	Sender       *viberCallbackUser    `json:"sender"`
+	User         *viberCallbackUser    `json:"user"`
+	Message      *viberCallbackMessage `json:"message"`
+	Context      string                `json:"context"`
+	Desc         string                `json:"desc"`
+}
+
+func (b *ViberBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *ViberBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *ViberBot) GetChannels() []string {
+	return viberChannels
+}
+
 func (b *ViberBot) activityToViber(v *Activity) viber.Message {
 	if v.TextFormat == Markdown {
 		v.Text = strings.Replace(v.Text, "*", "", -1)
@@ -153,12 +604,12 @@ func (b *ViberBot) activityToViber(v *Activity) viber.Message {
 		m = b.bot.NewTextMessage(v.Text)
 	}
 
-	if v.SuggestedActions != nil {
+	if v.SuggestedActions != nil && len(v.SuggestedActions.Actions) > 0 {
 		m.SetKeyboard(suggestedActionsToViber(v.SuggestedActions.Actions))
 	} else if attachment != nil && attachment.ContentType == TypeHeroCard {
 		card, ok := attachment.Content.(*HeroCard)
 
-		if ok {
+		if ok && len(card.Buttons) > 0 {
 			m.SetKeyboard(suggestedActionsToViber(card.Buttons))
 		}
 	}
@@ -167,13 +618,22 @@ func (b *ViberBot) activityToViber(v *Activity) viber.Message {
 }
 
 func suggestedActionsToViber(actions []*CardAction) *viber.Keyboard {
+	if len(actions) == 0 {
+		return nil
+	}
+
 	keyboard := &viber.Keyboard{
 		Type:          "keyboard",
 		DefaultHeight: false,
 	}
 
+	// Viber buttons span 1 to 6 columns; more than six actions wrap to new rows.
 	columns := 6 / len(actions)
 
+	if columns < 1 {
+		columns = 1
+	}
+
 	for _, action := range actions {
 		vButton := viber.Button{
 			Text:       action.Title,
@@ -0,0 +1,83 @@
+package bots
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func viberSignature(token, body string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestViberSignature(t *testing.T) {
+	body := `{"event":"message","timestamp":1,"message_token":5,"sender":{"id":"U1","name":"User"},"message":{"type":"text","text":"hi"}}`
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		status    int
+	}{
+		{"valid", body, viberSignature("token", body), http.StatusOK},
+		{"upper case", body, strings.ToUpper(viberSignature("token", body)), http.StatusOK},
+		{"tampered body", strings.Replace(body, "hi", "bye", 1), viberSignature("token", body), http.StatusForbidden},
+		{"wrong token", body, viberSignature("other", body), http.StatusForbidden},
+		{"missing signature", body, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, _ := NewViberBot(&ViberBotConfig{Token: "token"})
+			r := httptest.NewRequest(http.MethodPost, "/viber", strings.NewReader(tt.body))
+			r.Header.Set("X-Viber-Content-Signature", tt.signature)
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if tt.status == http.StatusOK && (activity == nil || activity.Text != "hi" || activity.From.Id != "U1") {
+				t.Fatalf("unexpected activity %+v", activity)
+			} else if tt.status != http.StatusOK && activity != nil {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+		})
+	}
+}
+
+func TestViberConversationStarted(t *testing.T) {
+	body := `{"event":"conversation_started","timestamp":1,"message_token":5,"type":"open","user":{"id":"U1","name":"User"}}`
+
+	tests := []struct {
+		name      string
+		callback  func(m *Activity) *Activity
+		delivered bool
+	}{
+		{"without callback", nil, true},
+		{"with callback", func(m *Activity) *Activity { return nil }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot, _ := NewViberBot(&ViberBotConfig{Token: "token", ConversationStarted: tt.callback})
+			r := httptest.NewRequest(http.MethodPost, "/viber", strings.NewReader(body))
+			r.Header.Set("X-Viber-Content-Signature", viberSignature("token", body))
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			if (activity != nil) != tt.delivered {
+				t.Fatalf("delivered = %v, want %v", activity != nil, tt.delivered)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package vibertest
+
+type Location struct {
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+	Address string  `json:"address,omitempty"`
+}
+
+type Contact struct {
+	Name        string `json:"name"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+type Message struct {
+	Type         string    `json:"type"`
+	Text         string    `json:"text,omitempty"`
+	Media        string    `json:"media,omitempty"`
+	Thumbnail    string    `json:"thumbnail,omitempty"`
+	FileName     string    `json:"file_name,omitempty"`
+	Size         uint      `json:"size,omitempty"`
+	Duration     uint      `json:"duration,omitempty"`
+	StickerId    int       `json:"sticker_id,omitempty"`
+	Location     *Location `json:"location,omitempty"`
+	Contact      *Contact  `json:"contact,omitempty"`
+	TrackingData string    `json:"tracking_data,omitempty"`
+}
+
+type Event struct {
+	Event        string   `json:"event"`
+	Timestamp    int64    `json:"timestamp"`
+	MessageToken uint64   `json:"message_token"`
+	UserId       string   `json:"user_id,omitempty"`
+	Sender       *User    `json:"sender,omitempty"`
+	User         *User    `json:"user,omitempty"`
+	Message      *Message `json:"message,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Context      string   `json:"context,omitempty"`
+	Subscribed   bool     `json:"subscribed,omitempty"`
+	Desc         string   `json:"desc,omitempty"`
+}
+
+func MessageEvent(sender *User, message *Message) *Event {
+	return &Event{Event: "message", Sender: sender, Message: message}
+}
+
+func TextMessageEvent(sender *User, text string) *Event {
+	return MessageEvent(sender, &Message{Type: "text", Text: text})
+}
+
+func ConversationStartedEvent(user *User, context string) *Event {
+	return &Event{Event: "conversation_started", User: user, Type: "open", Context: context}
+}
+
+func SubscribedEvent(user *User) *Event {
+	return &Event{Event: "subscribed", User: user}
+}
+
+func UnsubscribedEvent(userId string) *Event {
+	return &Event{Event: "unsubscribed", UserId: userId}
+}
+
+func DeliveredEvent(userId string, token uint64) *Event {
+	return &Event{Event: "delivered", UserId: userId, MessageToken: token}
+}
+
+func SeenEvent(userId string, token uint64) *Event {
+	return &Event{Event: "seen", UserId: userId, MessageToken: token}
+}
+
+func FailedEvent(userId string, token uint64, desc string) *Event {
+	return &Event{Event: "failed", UserId: userId, MessageToken: token, Desc: desc}
+}
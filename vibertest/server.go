@@ -0,0 +1,285 @@
+package vibertest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/viber"
+)
+
+type Webhook struct {
+	Url        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type SentMessage struct {
+	Receiver      string          `json:"receiver"`
+	Type          string          `json:"type"`
+	Text          string          `json:"text"`
+	Media         string          `json:"media"`
+	Thumbnail     string          `json:"thumbnail"`
+	FileName      string          `json:"file_name"`
+	TrackingData  string          `json:"tracking_data"`
+	BroadcastList []string        `json:"broadcast_list"`
+	Sender        viber.Sender    `json:"sender"`
+	Keyboard      *viber.Keyboard `json:"keyboard"`
+	Raw           json.RawMessage `json:"-"`
+	Token         uint64          `json:"-"`
+}
+
+type User struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Avatar   string `json:"avatar,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+type Server struct {
+	*httptest.Server
+	Token        string
+	Users        map[string]*User
+	unsubscribed map[string]bool
+	mu           sync.Mutex
+	webhooks     []*Webhook
+	messages     []*SentMessage
+	lastToken    uint64
+}
+
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:        token,
+		Users:        make(map[string]*User),
+		unsubscribed: make(map[string]bool),
+		lastToken:    uint64(time.Now().UnixNano()),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/set_webhook", s.authorized(s.handleSetWebhook))
+	mux.HandleFunc("/send_message", s.authorized(s.handleSendMessage))
+	mux.HandleFunc("/broadcast_message", s.authorized(s.handleBroadcastMessage))
+	mux.HandleFunc("/get_user_details", s.authorized(s.handleGetUserDetails))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) Config(webHookURL string) *bots.ViberBotConfig {
+	return &bots.ViberBotConfig{
+		Token:       s.Token,
+		WebHookURL:  webHookURL,
+		APIEndpoint: s.URL,
+	}
+}
+
+func (s *Server) AddUser(user *User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Users[user.Id] = user
+}
+
+func (s *Server) Unsubscribe(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsubscribed[id] = true
+}
+
+func (s *Server) Webhooks() []*Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Webhook(nil), s.webhooks...)
+}
+
+func (s *Server) Messages() []*SentMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*SentMessage(nil), s.messages...)
+}
+
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks = nil
+	s.messages = nil
+}
+
+func (s *Server) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.Token))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) Callback(handler http.Handler, event *Event) (*httptest.ResponseRecorder, error) {
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	if event.MessageToken == 0 {
+		event.MessageToken = s.nextToken()
+	}
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Viber-Content-Signature", s.Sign(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w, nil
+}
+
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Viber-Auth-Token") != s.Token {
+			writeStatus(w, 2, "invalidAuthToken", nil)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleSetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook := &Webhook{}
+
+	if err := json.NewDecoder(r.Body).Decode(webhook); err != nil || !strings.HasPrefix(webhook.Url, "https://") {
+		writeStatus(w, 1, "invalidUrl", nil)
+		return
+	}
+
+	s.mu.Lock()
+	s.webhooks = append(s.webhooks, webhook)
+	s.mu.Unlock()
+
+	eventTypes := webhook.EventTypes
+
+	if len(eventTypes) == 0 {
+		eventTypes = []string{"delivered", "seen", "failed", "subscribed", "unsubscribed", "conversation_started"}
+	}
+
+	writeStatus(w, 0, "ok", map[string]interface{}{"event_types": eventTypes})
+}
+
+func (s *Server) handleSendMessage(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	message := &SentMessage{}
+
+	if err == nil {
+		err = json.Unmarshal(body, message)
+	}
+
+	if err != nil {
+		writeStatus(w, 3, "badData", nil)
+		return
+	}
+
+	if message.Receiver == "" {
+		writeStatus(w, 5, "receiverNotRegistered", nil)
+		return
+	}
+
+	if s.isUnsubscribed(message.Receiver) {
+		writeStatus(w, 6, "notSubscribed", nil)
+		return
+	}
+
+	message.Raw = body
+	message.Token = s.nextToken()
+	s.mu.Lock()
+	s.messages = append(s.messages, message)
+	s.mu.Unlock()
+	writeStatus(w, 0, "ok", map[string]interface{}{"message_token": message.Token})
+}
+
+func (s *Server) handleBroadcastMessage(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	broadcast := &SentMessage{}
+
+	if err == nil {
+		err = json.Unmarshal(body, broadcast)
+	}
+
+	if err != nil || len(broadcast.BroadcastList) == 0 || len(broadcast.BroadcastList) > 300 {
+		writeStatus(w, 3, "badData", nil)
+		return
+	}
+
+	token := s.nextToken()
+	var failed []map[string]interface{}
+
+	for _, receiver := range broadcast.BroadcastList {
+		if s.isUnsubscribed(receiver) {
+			failed = append(failed, map[string]interface{}{"receiver": receiver, "status": 6, "status_message": "notSubscribed"})
+			continue
+		}
+
+		message := *broadcast
+		message.Receiver = receiver
+		message.Raw = body
+		message.Token = token
+		s.mu.Lock()
+		s.messages = append(s.messages, &message)
+		s.mu.Unlock()
+	}
+
+	writeStatus(w, 0, "ok", map[string]interface{}{"message_token": token, "failed_list": failed})
+}
+
+func (s *Server) isUnsubscribed(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unsubscribed[id]
+}
+
+func (s *Server) handleGetUserDetails(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Id string `json:"id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeStatus(w, 3, "badData", nil)
+		return
+	}
+
+	s.mu.Lock()
+	user, ok := s.Users[request.Id]
+	s.mu.Unlock()
+
+	if !ok {
+		writeStatus(w, 5, "receiverNotRegistered", nil)
+		return
+	}
+
+	writeStatus(w, 0, "ok", map[string]interface{}{"user": user})
+}
+
+func (s *Server) nextToken() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastToken++
+	return s.lastToken
+}
+
+func writeStatus(w http.ResponseWriter, status int, message string, fields map[string]interface{}) {
+	result := map[string]interface{}{"status": status, "status_message": message}
+
+	for k, v := range fields {
+		result[k] = v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,177 @@
+package bots_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nickalie/bots"
+	"github.com/nickalie/bots/vibertest"
+)
+
+func TestViberWithFakeServer(t *testing.T) {
+	server := vibertest.NewServer("token")
+	defer server.Close()
+	bot, err := bots.NewViberBot(server.Config("https://example.com/viber"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates, err := bot.GetUpdatesChannelContext(ctx)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if webhooks := server.Webhooks(); len(webhooks) != 1 || webhooks[0].Url != "https://example.com/viber" {
+		t.Fatalf("unexpected webhooks %+v", webhooks)
+	}
+
+	user := &vibertest.User{Id: "U1", Name: "User"}
+	served := make(chan int, 1)
+
+	go func() {
+		w, _ := server.Callback(bot, vibertest.TextMessageEvent(user, "hi"))
+		served <- w.Code
+	}()
+
+	var activity *bots.Activity
+
+	select {
+	case activity = <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no activity delivered")
+	}
+
+	if code := <-served; code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+
+	if activity.Text != "hi" || activity.From.Id != "U1" {
+		t.Fatalf("unexpected activity %+v", activity)
+	}
+
+	if _, err = bot.SendContext(ctx, activity.Response("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	if messages := server.Messages(); len(messages) != 1 || messages[0].Receiver != "U1" || messages[0].Text != "hello" {
+		t.Fatalf("unexpected messages %+v", messages)
+	}
+}
+
+func TestViberRejectsForeignSignature(t *testing.T) {
+	server := vibertest.NewServer("token")
+	defer server.Close()
+	other := vibertest.NewServer("other")
+	defer other.Close()
+	bot, _ := bots.NewViberBot(server.Config("https://example.com/viber"))
+	w, err := other.Callback(bot, vibertest.TextMessageEvent(&vibertest.User{Id: "U1"}, "hi"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestViberSenderAndKeyboard(t *testing.T) {
+	server := vibertest.NewServer("token")
+	defer server.Close()
+	config := server.Config("")
+	config.SenderName = "Pizza Bot"
+	config.SenderAvatar = "https://example.com/avatar.png"
+	bot, err := bots.NewViberBot(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := func(n int) []*bots.CardAction {
+		result := make([]*bots.CardAction, n)
+
+		for i := range result {
+			result[i] = &bots.CardAction{Type: bots.TypeImBack, Title: "option", Value: "option"}
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		activity *bots.Activity
+		buttons  int
+		columns  int
+	}{
+		{"no actions", &bots.Activity{SuggestedActions: &bots.SuggestedActions{}}, 0, 0},
+		{"card without buttons", &bots.Activity{Attachments: []*bots.Attachment{
+			{ContentType: bots.TypeHeroCard, Content: &bots.HeroCard{Title: "Pizza"}},
+		}}, 0, 0},
+		{"two actions", &bots.Activity{SuggestedActions: &bots.SuggestedActions{Actions: actions(2)}}, 2, 3},
+		{"eight actions", &bots.Activity{SuggestedActions: &bots.SuggestedActions{Actions: actions(8)}}, 8, 1},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activity := viberActivity()
+			activity.SuggestedActions = tt.activity.SuggestedActions
+			activity.Attachments = tt.activity.Attachments
+
+			if _, err := bot.Send(activity); err != nil {
+				t.Fatal(err)
+			}
+
+			messages := server.Messages()
+
+			if len(messages) != i+1 {
+				t.Fatalf("server got %d messages, want %d", len(messages), i+1)
+			}
+
+			message := messages[i]
+
+			if message.Sender.Name != "Pizza Bot" || message.Sender.Avatar != "https://example.com/avatar.png" {
+				t.Fatalf("sender = %+v", message.Sender)
+			}
+
+			if tt.buttons == 0 {
+				if message.Keyboard != nil {
+					t.Fatalf("unexpected keyboard %+v", message.Keyboard)
+				}
+
+				return
+			}
+
+			if message.Keyboard == nil || len(message.Keyboard.Buttons) != tt.buttons {
+				t.Fatalf("keyboard = %+v, want %d buttons", message.Keyboard, tt.buttons)
+			}
+
+			for _, button := range message.Keyboard.Buttons {
+				if button.Columns != tt.columns {
+					t.Fatalf("button spans %d columns, want %d", button.Columns, tt.columns)
+				}
+			}
+		})
+	}
+
+	defaults, err := bots.NewViberBot(server.Config(""))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := defaults.Send(viberActivity()); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := server.Messages()
+
+	if sender := messages[len(messages)-1].Sender; sender.Name == "" || sender.Avatar != "" {
+		t.Fatalf("default sender = %+v", sender)
+	}
+}
@@ -0,0 +1,85 @@
+package bots
+
+type WaterfallStepFunc func(step *WaterfallStep) (*DialogTurnResult, error)
+
+type WaterfallStep struct {
+	*DialogContext
+	Index   int
+	Options interface{}
+	Result  interface{}
+	Values  map[string]interface{}
+	dialog  *WaterfallDialog
+}
+
+func (s *WaterfallStep) Next(result interface{}) (*DialogTurnResult, error) {
+	return s.dialog.runStep(s.DialogContext, s.Index+1, result)
+}
+
+func (s *WaterfallStep) Prompt(dialogId string, options *PromptOptions) (*DialogTurnResult, error) {
+	return s.Begin(dialogId, options)
+}
+
+type WaterfallDialog struct {
+	id    string
+	steps []WaterfallStepFunc
+}
+
+func NewWaterfallDialog(id string, steps ...WaterfallStepFunc) *WaterfallDialog {
+	return &WaterfallDialog{id: id, steps: steps}
+}
+
+func (d *WaterfallDialog) Id() string {
+	return d.id
+}
+
+func (d *WaterfallDialog) Begin(dc *DialogContext, options interface{}) (*DialogTurnResult, error) {
+	state := dc.ActiveDialog().State
+	state["options"] = options
+	state["values"] = make(map[string]interface{})
+	return d.runStep(dc, 0, nil)
+}
+
+func (d *WaterfallDialog) Continue(dc *DialogContext) (*DialogTurnResult, error) {
+	if dc.Turn.Activity.Type != TypeMessage {
+		return &DialogTurnResult{Status: DialogWaiting}, nil
+	}
+
+	return d.Resume(dc, dc.Turn.Activity.Text)
+}
+
+func (d *WaterfallDialog) Resume(dc *DialogContext, result interface{}) (*DialogTurnResult, error) {
+	return d.runStep(dc, stateInt(dc.ActiveDialog().State, "stepIndex")+1, result)
+}
+
+func (d *WaterfallDialog) runStep(dc *DialogContext, index int, result interface{}) (*DialogTurnResult, error) {
+	if index >= len(d.steps) {
+		return dc.End(result)
+	}
+
+	state := dc.ActiveDialog().State
+	state["stepIndex"] = index
+	values, _ := state["values"].(map[string]interface{})
+
+	if values == nil {
+		values = make(map[string]interface{})
+		state["values"] = values
+	}
+
+	step := &WaterfallStep{
+		DialogContext: dc,
+		Index:         index,
+		Options:       state["options"],
+		Result:        result,
+		Values:        values,
+		dialog:        d,
+	}
+
+	turnResult, err := d.steps[index](step)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dc.save()
+	return turnResult, nil
+}
@@ -0,0 +1,26 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+func serveWebhook(handler http.Handler, updates <-chan *Activity, r *http.Request) (*httptest.ResponseRecorder, *Activity) {
+	received := make(chan *Activity, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(received)
+
+		select {
+		case activity := <-updates:
+			received <- activity
+		case <-done:
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	close(done)
+	return w, <-received
+}
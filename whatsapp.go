@@ -0,0 +1,493 @@
+package bots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+const (
+	whatsAppMaxButtons  = 3
+	whatsAppMaxListRows = 10
+)
+
+var whatsAppChannels = []string{ChannelWhatsApp}
+
+type WhatsAppBotConfig struct {
+	AccessToken   string
+	PhoneNumberId string
+	AppSecret     string
+	VerifyToken   string
+	APIEndpoint   string
+}
+
+type WhatsAppBot struct {
+	config    *WhatsAppBotConfig
+	updates   chan *Activity
+	lifecycle *lifecycle
+}
+
+func NewWhatsAppBot(config *WhatsAppBotConfig) *WhatsAppBot {
+	if config.APIEndpoint == "" {
+		config.APIEndpoint = graphAPI
+	}
+
+	return &WhatsAppBot{
+		config:    config,
+		updates:   make(chan *Activity),
+		lifecycle: newLifecycle(),
+	}
+}
+
+func (b *WhatsAppBot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		verifyHubChallenge(w, r, b.config.VerifyToken)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		errorResponse(w, "unsupported method: "+r.Method)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		errorResponse(w, "unable to read body")
+		return
+	}
+
+	if !validHubSignature(b.config.AppSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	callback := &whatsAppCallback{}
+
+	if err = json.Unmarshal(body, callback); err != nil {
+		errorResponse(w, "invalid payload")
+		return
+	}
+
+	if !b.lifecycle.enter() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	defer b.lifecycle.leave()
+
+	for _, entry := range callback.Entry {
+		for _, change := range entry.Changes {
+			if change.Field != "messages" {
+				continue
+			}
+
+			names := make(map[string]string)
+
+			for _, c := range change.Value.Contacts {
+				names[c.WaId] = c.Profile.Name
+			}
+
+			for _, m := range change.Value.Messages {
+				activity := whatsAppToActivity(m, change.Value.Metadata.PhoneNumberId, names[m.From])
+
+				if activity == nil {
+					continue
+				}
+
+				if !b.lifecycle.deliver(b.updates, activity) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *WhatsAppBot) GetUpdatesChannel() (<-chan *Activity, error) {
+	return b.updates, nil
+}
+
+func (b *WhatsAppBot) GetUpdatesChannelContext(ctx context.Context) (<-chan *Activity, error) {
+	return forwardUpdates(ctx, b.updates), nil
+}
+
+func (b *WhatsAppBot) Send(activity *Activity) (*Identification, error) {
+	return b.SendContext(context.Background(), activity)
+}
+
+func (b *WhatsAppBot) SendContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	if activity.Type == TypeTyping {
+		return nil, nil
+	}
+
+	to := targetUserId(activity)
+	result := &Identification{}
+
+	for _, message := range whatsAppMessages(activity) {
+		message["messaging_product"] = "whatsapp"
+		message["to"] = to
+
+		var response struct {
+			Messages []struct {
+				Id string `json:"id"`
+			} `json:"messages"`
+		}
+
+		err := b.call(ctx, http.MethodPost, "/"+b.config.PhoneNumberId+"/messages", message, &response)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(response.Messages) > 0 {
+			result.Id = response.Messages[0].Id
+		}
+	}
+
+	return result, nil
+}
+
+func (b *WhatsAppBot) Update(activity *Activity) (*Identification, error) {
+	return b.UpdateContext(context.Background(), activity)
+}
+
+func (b *WhatsAppBot) UpdateContext(ctx context.Context, activity *Activity) (*Identification, error) {
+	return nil, errors.New("update isn't implemented for whatsapp")
+}
+
+func (b *WhatsAppBot) Delete(activity *Activity) error {
+	return b.DeleteContext(context.Background(), activity)
+}
+
+func (b *WhatsAppBot) DeleteContext(ctx context.Context, activity *Activity) error {
+	return errors.New("delete isn't implemented for whatsapp")
+}
+
+func (b *WhatsAppBot) GetFile(attachment *Attachment, activity *Activity) (*http.Response, error) {
+	return b.GetFileContext(context.Background(), attachment, activity)
+}
+
+func (b *WhatsAppBot) GetFileContext(ctx context.Context, attachment *Attachment, activity *Activity) (*http.Response, error) {
+	fileUrl := attachment.ContentUrl
+
+	if !strings.HasPrefix(fileUrl, "http://") && !strings.HasPrefix(fileUrl, "https://") {
+		var media struct {
+			Url string `json:"url"`
+		}
+
+		err := b.call(ctx, http.MethodGet, "/"+attachment.ContentUrl, nil, &media)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fileUrl = media.Url
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fileUrl, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+b.config.AccessToken)
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+func (b *WhatsAppBot) GetChannels() []string {
+	return whatsAppChannels
+}
+
+func (b *WhatsAppBot) Shutdown(ctx context.Context) error {
+	return b.lifecycle.shutdown(ctx, b.updates)
+}
+
+func (b *WhatsAppBot) Close() error {
+	ctx, cancel := closeContext()
+	defer cancel()
+	return b.Shutdown(ctx)
+}
+
+func (b *WhatsAppBot) call(ctx context.Context, method, path string, payload interface{}, result interface{}) error {
+	request := gorequest.New()
+
+	if method == http.MethodGet {
+		request.Get(b.config.APIEndpoint + path)
+	} else {
+		request.Post(b.config.APIEndpoint + path).Send(payload)
+	}
+
+	request.Set("Authorization", "Bearer "+b.config.AccessToken)
+	resp, body, err := endRequest(ctx, request)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return errors.New(fmt.Sprintf("whatsapp %s failed: %s %d", path, body, resp.StatusCode))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+type whatsAppCallback struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		Id      string `json:"id"`
+		Changes []struct {
+			Field string `json:"field"`
+			Value struct {
+				Metadata struct {
+					PhoneNumberId string `json:"phone_number_id"`
+				} `json:"metadata"`
+				Contacts []struct {
+					WaId    string `json:"wa_id"`
+					Profile struct {
+						Name string `json:"name"`
+					} `json:"profile"`
+				} `json:"contacts"`
+				Messages []*whatsAppMessage `json:"messages"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+type whatsAppMedia struct {
+	Id       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	Caption  string `json:"caption"`
+	Filename string `json:"filename"`
+}
+
+type whatsAppReply struct {
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type whatsAppMessage struct {
+	From string `json:"from"`
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Text *struct {
+		Body string `json:"body"`
+	} `json:"text"`
+	Image    *whatsAppMedia `json:"image"`
+	Audio    *whatsAppMedia `json:"audio"`
+	Video    *whatsAppMedia `json:"video"`
+	Document *whatsAppMedia `json:"document"`
+	Sticker  *whatsAppMedia `json:"sticker"`
+	Location *struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Name      string  `json:"name"`
+		Address   string  `json:"address"`
+	} `json:"location"`
+	Interactive *struct {
+		Type        string         `json:"type"`
+		ButtonReply *whatsAppReply `json:"button_reply"`
+		ListReply   *whatsAppReply `json:"list_reply"`
+	} `json:"interactive"`
+	Button *struct {
+		Payload string `json:"payload"`
+		Text    string `json:"text"`
+	} `json:"button"`
+}
+
+func whatsAppToActivity(m *whatsAppMessage, phoneNumberId, name string) *Activity {
+	result := &Activity{}
+	result.Id = m.Id
+	result.ChannelId = ChannelWhatsApp
+	result.Type = TypeMessage
+	result.From = &ChannelAccount{Identification: Identification{Id: m.From}, Name: name}
+	result.Recipient = &ChannelAccount{Identification: Identification{Id: phoneNumberId}}
+	result.Conversation = &ConversationAccount{ChannelAccount: *result.From}
+
+	switch {
+	case m.Text != nil:
+		result.Text = m.Text.Body
+	case m.Location != nil:
+		result.Attachments = append(result.Attachments, &Attachment{
+			ContentType: TypeGeoCoordinates,
+			Name:        m.Location.Name,
+			Content: &GeoCoordinates{
+				Latitude:  m.Location.Latitude,
+				Longitude: m.Location.Longitude,
+				Name:      m.Location.Name,
+				Address:   m.Location.Address,
+			},
+		})
+	case m.Interactive != nil && m.Interactive.ButtonReply != nil:
+		result.Text = m.Interactive.ButtonReply.Id
+		result.Value = m.Interactive.ButtonReply
+	case m.Interactive != nil && m.Interactive.ListReply != nil:
+		result.Text = m.Interactive.ListReply.Id
+		result.Value = m.Interactive.ListReply
+	case m.Button != nil:
+		result.Text = m.Button.Payload
+	default:
+		for _, media := range []*whatsAppMedia{m.Image, m.Audio, m.Video, m.Document, m.Sticker} {
+			if media == nil {
+				continue
+			}
+
+			result.Text = media.Caption
+			result.Attachments = append(result.Attachments, &Attachment{
+				ContentType: media.MimeType,
+				ContentUrl:  media.Id,
+				Name:        media.Filename,
+			})
+		}
+
+		if len(result.Attachments) == 0 {
+			return nil
+		}
+	}
+
+	return result
+}
+
+func whatsAppMessages(activity *Activity) []map[string]interface{} {
+	var messages []map[string]interface{}
+	text := activity.Text
+
+	for _, a := range activity.Attachments {
+		if a.ContentType == TypeHeroCard {
+			card, ok := a.Content.(*HeroCard)
+
+			if !ok {
+				continue
+			}
+
+			body := joinText(card.Title, card.Text)
+			var buttons []*CardAction
+
+			for _, action := range card.Buttons {
+				if action.Type == TypeOpenUrl {
+					body = joinText(body, action.Title+": "+action.Value)
+				} else {
+					buttons = append(buttons, action)
+				}
+			}
+
+			if len(buttons) == 0 {
+				if len(card.Images) > 0 {
+					messages = append(messages, whatsAppImage(card.Images[0].Url, body))
+				} else {
+					messages = append(messages, whatsAppText(body))
+				}
+
+				continue
+			}
+
+			message := whatsAppInteractive(body, buttons)
+
+			if len(card.Images) > 0 && len(buttons) <= whatsAppMaxButtons {
+				message["interactive"].(map[string]interface{})["header"] = map[string]interface{}{
+					"type":  "image",
+					"image": map[string]string{"link": card.Images[0].Url},
+				}
+			}
+
+			messages = append(messages, message)
+		} else if strings.HasPrefix(a.ContentType, "image") && a.ContentUrl != "" {
+			messages = append(messages, whatsAppImage(a.ContentUrl, ""))
+		} else if a.ContentUrl != "" {
+			messages = append(messages, map[string]interface{}{
+				"type":     "document",
+				"document": map[string]string{"link": a.ContentUrl, "filename": a.Name},
+			})
+		}
+	}
+
+	if activity.SuggestedActions != nil && len(activity.SuggestedActions.Actions) > 0 {
+		if text == "" {
+			text = "Choose an option"
+		}
+
+		messages = append(messages, whatsAppInteractive(text, activity.SuggestedActions.Actions))
+	} else if text != "" {
+		messages = append([]map[string]interface{}{whatsAppText(text)}, messages...)
+	}
+
+	return messages
+}
+
+func whatsAppText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "text", "text": map[string]string{"body": text}}
+}
+
+func whatsAppImage(link, caption string) map[string]interface{} {
+	image := map[string]string{"link": link}
+
+	if caption != "" {
+		image["caption"] = caption
+	}
+
+	return map[string]interface{}{"type": "image", "image": image}
+}
+
+func whatsAppInteractive(body string, actions []*CardAction) map[string]interface{} {
+	if body == "" {
+		body = "Choose an option"
+	}
+
+	interactive := map[string]interface{}{"body": map[string]string{"text": body}}
+
+	if len(actions) <= whatsAppMaxButtons {
+		var buttons []map[string]interface{}
+
+		for _, action := range actions {
+			buttons = append(buttons, map[string]interface{}{
+				"type":  "reply",
+				"reply": map[string]string{"id": action.Value, "title": truncate(action.Title, 20)},
+			})
+		}
+
+		interactive["type"] = "button"
+		interactive["action"] = map[string]interface{}{"buttons": buttons}
+	} else {
+		var rows []map[string]string
+
+		for i, action := range actions {
+			if i == whatsAppMaxListRows {
+				break
+			}
+
+			rows = append(rows, map[string]string{"id": action.Value, "title": truncate(action.Title, 24)})
+		}
+
+		interactive["type"] = "list"
+		interactive["action"] = map[string]interface{}{
+			"button":   "Choose",
+			"sections": []map[string]interface{}{{"rows": rows}},
+		}
+	}
+
+	return map[string]interface{}{"type": "interactive", "interactive": interactive}
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+
+	if len(runes) <= length {
+		return s
+	}
+
+	return string(runes[:length])
+}
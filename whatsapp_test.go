@@ -0,0 +1,49 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWhatsAppSignature(t *testing.T) {
+	body := `{"object":"whatsapp_business_account","entry":[{"id":"E1","changes":[{"field":"messages","value":{"metadata":{"phone_number_id":"P1"},"contacts":[{"wa_id":"U1","profile":{"name":"User"}}],"messages":[{"from":"U1","id":"m1","type":"text","text":{"body":"hi"}}]}}]}]}`
+
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		status    int
+	}{
+		{"valid", body, hubSignature("secret", body), http.StatusOK},
+		{"tampered body", strings.Replace(body, `"hi"`, `"bye"`, 1), hubSignature("secret", body), http.StatusUnauthorized},
+		{"wrong secret", body, hubSignature("other", body), http.StatusUnauthorized},
+		{"missing signature", body, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := NewWhatsAppBot(&WhatsAppBotConfig{AppSecret: "secret"})
+			r := httptest.NewRequest(http.MethodPost, "/whatsapp", strings.NewReader(tt.body))
+			r.Header.Set("X-Hub-Signature-256", tt.signature)
+			w, activity := serveWebhook(bot, bot.updates, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			if tt.status != http.StatusOK {
+				if activity != nil {
+					t.Fatalf("unexpected activity %+v", activity)
+				}
+
+				return
+			}
+
+			if activity == nil || activity.Text != "hi" || activity.From.Name != "User" || activity.Recipient.Id != "P1" {
+				t.Fatalf("unexpected activity %+v", activity)
+			}
+		})
+	}
+}